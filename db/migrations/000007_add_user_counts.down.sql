@@ -0,0 +1,4 @@
+ALTER TABLE users
+  DROP COLUMN IF EXISTS followers_count,
+  DROP COLUMN IF EXISTS followees_count,
+  DROP COLUMN IF EXISTS tweets_count;
@@ -0,0 +1,12 @@
+-- フォロワー数・フォロー数・ツイート数を users に非正規化して持つ
+-- follows / tweets の書き込みと同じトランザクションで更新する
+ALTER TABLE users
+  ADD COLUMN followers_count INTEGER NOT NULL DEFAULT 0 CHECK (followers_count >= 0),
+  ADD COLUMN followees_count INTEGER NOT NULL DEFAULT 0 CHECK (followees_count >= 0),
+  ADD COLUMN tweets_count INTEGER NOT NULL DEFAULT 0 CHECK (tweets_count >= 0);
+
+-- 既存データからバックフィル
+UPDATE users u SET
+  followers_count = (SELECT COUNT(*) FROM follows f WHERE f.followee_id = u.id),
+  followees_count = (SELECT COUNT(*) FROM follows f WHERE f.follower_id = u.id),
+  tweets_count = (SELECT COUNT(*) FROM tweets t WHERE t.user_id = u.id);
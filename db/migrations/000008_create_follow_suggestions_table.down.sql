@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS follow_suggestion_runs;
+DROP TABLE IF EXISTS follow_suggestions;
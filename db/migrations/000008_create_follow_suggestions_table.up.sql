@@ -0,0 +1,15 @@
+-- 「おすすめユーザー」の事前計算結果（ユーザーごとのキャッシュ）
+-- 友達の友達の重なりで順位付けした候補を保持する
+CREATE TABLE follow_suggestions (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    suggested_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    mutual_count INTEGER NOT NULL CHECK (mutual_count > 0),
+    sample_followee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, suggested_user_id)
+);
+
+-- ユーザーごとの最終計算日時（候補が 0 件でも計算済みとわかるように別テーブルで持つ）
+CREATE TABLE follow_suggestion_runs (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    computed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS muted_words;
+DROP TABLE IF EXISTS mutes;
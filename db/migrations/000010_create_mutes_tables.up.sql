@@ -0,0 +1,18 @@
+-- ミュート: ブロックと違いフォロー関係は残したまま、ホームフィードからだけ隠す
+CREATE TABLE mutes (
+    muter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    muted_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (muter_id, muted_id),
+    CHECK (muter_id != muted_id)
+);
+
+-- ミュートワード（キーワード・ハッシュタグ）。expires_at が NULL なら無期限
+CREATE TABLE muted_words (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    word VARCHAR(100) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (user_id, word)
+);
@@ -0,0 +1,13 @@
+-- 鍵アカウント: protected なユーザーへのフォローは承認制になり、ツイートはフォロワーにしか見えない
+ALTER TABLE users ADD COLUMN protected BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE follow_requests (
+    requester_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (requester_id, target_id),
+    CHECK (requester_id != target_id)
+);
+
+-- 鍵アカウントの持ち主が届いたリクエストを新しい順に一覧するためのインデックス
+CREATE INDEX idx_follow_requests_target_created ON follow_requests(target_id, created_at DESC);
@@ -0,0 +1,10 @@
+-- ブックマークは本人にしか見えない
+CREATE TABLE bookmarks (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    tweet_id UUID NOT NULL REFERENCES tweets(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, tweet_id)
+);
+
+-- GET /users/me/bookmarks のカーソルページネーション用
+CREATE INDEX idx_bookmarks_user_created ON bookmarks(user_id, created_at DESC, tweet_id DESC);
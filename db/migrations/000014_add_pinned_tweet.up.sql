@@ -0,0 +1,2 @@
+-- プロフィールに固定するツイート。ツイートが削除されたら固定も外れる
+ALTER TABLE users ADD COLUMN pinned_tweet_id UUID REFERENCES tweets(id) ON DELETE SET NULL;
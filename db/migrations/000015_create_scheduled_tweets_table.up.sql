@@ -0,0 +1,15 @@
+-- 予約投稿。publish_at を過ぎたらバックグラウンドの publisher が tweets に移す
+CREATE TABLE scheduled_tweets (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content VARCHAR(255) NOT NULL,
+    publish_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- publisher が期限の来た予約を古い順に拾うためのインデックス
+CREATE INDEX idx_scheduled_tweets_publish_at ON scheduled_tweets(publish_at);
+
+-- 本人の予約一覧用
+CREATE INDEX idx_scheduled_tweets_user_publish_at ON scheduled_tweets(user_id, publish_at);
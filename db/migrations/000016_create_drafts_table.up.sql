@@ -0,0 +1,10 @@
+-- 書きかけのツイート。端末をまたいで同期するためにサーバー側に保存する
+CREATE TABLE drafts (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_drafts_user_updated ON drafts(user_id, updated_at DESC);
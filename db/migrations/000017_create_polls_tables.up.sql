@@ -0,0 +1,24 @@
+-- ツイートに付ける投票（1ツイートにつき1つ）
+CREATE TABLE polls (
+    tweet_id UUID PRIMARY KEY REFERENCES tweets(id) ON DELETE CASCADE,
+    closes_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE poll_options (
+    tweet_id UUID NOT NULL REFERENCES polls(tweet_id) ON DELETE CASCADE,
+    position SMALLINT NOT NULL CHECK (position BETWEEN 0 AND 3),
+    label VARCHAR(25) NOT NULL,
+    votes_count INTEGER NOT NULL DEFAULT 0 CHECK (votes_count >= 0),
+    PRIMARY KEY (tweet_id, position)
+);
+
+-- 主キーで1ユーザー1票を保証する
+CREATE TABLE poll_votes (
+    tweet_id UUID NOT NULL REFERENCES polls(tweet_id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    position SMALLINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tweet_id, user_id),
+    FOREIGN KEY (tweet_id, position) REFERENCES poll_options(tweet_id, position) ON DELETE CASCADE
+);
@@ -0,0 +1,22 @@
+-- アップロードされた画像。ファイル本体はストレージ（ローカルまたは S3 互換）に置き、ここにはメタデータと公開 URL を持つ
+CREATE TABLE media (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content_type VARCHAR(50) NOT NULL,
+    size_bytes INTEGER NOT NULL CHECK (size_bytes > 0),
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    storage_key VARCHAR(255) NOT NULL,
+    thumbnail_key VARCHAR(255) NOT NULL,
+    url TEXT NOT NULL,
+    thumbnail_url TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- ツイートに添付した画像（1ツイート最大4枚、1つの画像は1ツイートにだけ添付できる）
+CREATE TABLE tweet_media (
+    tweet_id UUID NOT NULL REFERENCES tweets(id) ON DELETE CASCADE,
+    media_id UUID NOT NULL UNIQUE REFERENCES media(id) ON DELETE CASCADE,
+    position SMALLINT NOT NULL CHECK (position BETWEEN 0 AND 3),
+    PRIMARY KEY (tweet_id, position)
+);
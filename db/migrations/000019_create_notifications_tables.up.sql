@@ -0,0 +1,26 @@
+-- 通知。同じ種類・同じ対象の未読通知は1件にまとめ、アクターを notification_actors に積む
+-- group_key: follow は 'follow'、ツイートに紐づくものは '<type>:<tweet_id>'
+CREATE TABLE notifications (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(16) NOT NULL CHECK (type IN ('follow', 'mention', 'like', 'reply')),
+    tweet_id UUID REFERENCES tweets(id) ON DELETE CASCADE,
+    group_key VARCHAR(64) NOT NULL,
+    actors_count INTEGER NOT NULL DEFAULT 0 CHECK (actors_count >= 0),
+    read_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- 未読の間だけ同じグループに集約する（既読になったら次のイベントは新しい通知になる）
+CREATE UNIQUE INDEX idx_notifications_unread_group ON notifications(user_id, group_key) WHERE read_at IS NULL;
+
+-- GET /users/me/notifications のカーソルページネーション用（最後のアクティビティ順）
+CREATE INDEX idx_notifications_user_updated ON notifications(user_id, updated_at DESC, id DESC);
+
+CREATE TABLE notification_actors (
+    notification_id UUID NOT NULL REFERENCES notifications(id) ON DELETE CASCADE,
+    actor_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (notification_id, actor_id)
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS conversation_members;
+DROP TABLE IF EXISTS conversations;
+ALTER TABLE users DROP COLUMN IF EXISTS dm_followees_only;
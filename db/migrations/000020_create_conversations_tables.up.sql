@@ -0,0 +1,35 @@
+-- TRUE なら自分がフォローしている人からしか DM を受け取らない
+ALTER TABLE users ADD COLUMN dm_followees_only BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- DM の会話。1対1の会話は direct_key（2人のユーザーIDを昇順に ':' でつないだもの）で1つに保つ
+-- グループの会話は direct_key が NULL
+CREATE TABLE conversations (
+    id UUID PRIMARY KEY,
+    creator_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    direct_key VARCHAR(73) UNIQUE,
+    last_message_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- last_read_message_id は既読位置（既読表示に使う）
+CREATE TABLE conversation_members (
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    last_read_message_id UUID,
+    last_read_at TIMESTAMP WITH TIME ZONE,
+    joined_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (conversation_id, user_id)
+);
+
+CREATE INDEX idx_conversation_members_user ON conversation_members(user_id, conversation_id);
+
+CREATE TABLE messages (
+    id UUID PRIMARY KEY,
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    sender_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- メッセージのカーソルページネーション・最新メッセージの取得用
+CREATE INDEX idx_messages_conversation_created ON messages(conversation_id, created_at DESC, id DESC);
@@ -0,0 +1,26 @@
+-- ドメインイベントの outbox。変更と同じトランザクションで書き込み、relay がコミット後に購読者へ配る
+-- published_at は全ての購読者が処理し終えた日時
+CREATE TABLE outbox (
+    id UUID PRIMARY KEY,
+    event_type VARCHAR(32) NOT NULL,
+    aggregate_id UUID NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_error TEXT,
+    published_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- 未配信のイベントの取り出し用
+CREATE INDEX idx_outbox_pending ON outbox(next_attempt_at) WHERE published_at IS NULL;
+-- 配信済みのイベントの掃除用
+CREATE INDEX idx_outbox_published ON outbox(published_at) WHERE published_at IS NOT NULL;
+
+-- 購読者ごとの処理済みの記録。再試行のときに処理済みの購読者には配らない
+CREATE TABLE outbox_consumed (
+    event_id UUID NOT NULL REFERENCES outbox(id) ON DELETE CASCADE,
+    consumer VARCHAR(64) NOT NULL,
+    consumed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (event_id, consumer)
+);
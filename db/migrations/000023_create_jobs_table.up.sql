@@ -0,0 +1,26 @@
+-- バックグラウンドジョブのキュー。queued のジョブを SKIP LOCKED で取り出して running にする
+-- running のジョブは locked_until（可視性タイムアウト）を過ぎたら、ワーカーが落ちたものとして取り直される
+CREATE TABLE jobs (
+    id UUID PRIMARY KEY,
+    queue VARCHAR(64) NOT NULL,
+    kind VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'succeeded', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL CHECK (max_attempts > 0),
+    run_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMP WITH TIME ZONE,
+    last_error TEXT,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- 実行待ちのジョブの取り出し用
+CREATE INDEX idx_jobs_queued ON jobs(queue, run_at) WHERE status = 'queued';
+-- 可視性タイムアウトを過ぎた実行中のジョブの取り直し用
+CREATE INDEX idx_jobs_running ON jobs(queue, locked_until) WHERE status = 'running';
+-- 管理 API の一覧（カーソルページネーション）用
+CREATE INDEX idx_jobs_queue_created ON jobs(queue, created_at DESC, id DESC);
+-- 終わったジョブの掃除用
+CREATE INDEX idx_jobs_finished ON jobs(finished_at) WHERE finished_at IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS remote_followers;
+DROP TABLE IF EXISTS actor_keys;
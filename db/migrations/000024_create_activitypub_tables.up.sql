@@ -0,0 +1,19 @@
+-- ActivityPub の actor の鍵。HTTP Signatures で配信に署名し、actor ドキュメントで公開鍵を公開する
+-- 最初に必要になったとき（actor ドキュメントの取得・配信）に作る
+CREATE TABLE actor_keys (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    public_key_pem TEXT NOT NULL,
+    private_key_pem TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- 他のサーバー（fediverse）からのフォロワー。新しいツイートを Create として inbox に配信する
+CREATE TABLE remote_followers (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor_uri VARCHAR(2048) NOT NULL,
+    inbox_url VARCHAR(2048) NOT NULL,
+    shared_inbox_url VARCHAR(2048),
+    follow_activity_id VARCHAR(2048) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, actor_uri)
+);
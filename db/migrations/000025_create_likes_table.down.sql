@@ -0,0 +1,3 @@
+ALTER TABLE notifications DROP CONSTRAINT notifications_type_check;
+ALTER TABLE notifications ADD CONSTRAINT notifications_type_check CHECK (type IN ('follow', 'mention', 'like', 'reply'));
+DROP TABLE IF EXISTS likes;
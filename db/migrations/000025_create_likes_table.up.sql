@@ -0,0 +1,11 @@
+-- いいね。tweets.likes_count はいいねの追加・取り消しと同じトランザクションで増減する
+CREATE TABLE likes (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    tweet_id UUID NOT NULL REFERENCES tweets(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, tweet_id)
+);
+
+-- リプライはツイートに返信先を持たせていないので通知の種類から外す
+ALTER TABLE notifications DROP CONSTRAINT notifications_type_check;
+ALTER TABLE notifications ADD CONSTRAINT notifications_type_check CHECK (type IN ('follow', 'mention', 'like'));
@@ -0,0 +1,3 @@
+ALTER TABLE muted_words DROP COLUMN IF EXISTS pattern;
+DROP INDEX IF EXISTS idx_muted_words_user_word;
+ALTER TABLE muted_words ADD CONSTRAINT muted_words_user_id_word_key UNIQUE (user_id, word);
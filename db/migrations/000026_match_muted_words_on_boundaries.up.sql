@@ -0,0 +1,16 @@
+-- 大文字小文字だけが違うミュートワードは、後から登録した方だけを残す
+DELETE FROM muted_words a
+USING muted_words b
+WHERE a.user_id = b.user_id AND lower(a.word) = lower(b.word) AND a.id < b.id;
+
+ALTER TABLE muted_words DROP CONSTRAINT muted_words_user_id_word_key;
+CREATE UNIQUE INDEX idx_muted_words_user_word ON muted_words(user_id, lower(word));
+
+-- pattern: ツイート本文に ~* で当てる正規表現
+-- word の端が英数字・_ なら、その側の隣が英数字・_ でないことを求める（"go" は "#go" や "go!" に当たるが "golang" には当たらない）
+-- 日本語のように単語を空白で区切らない文字の端には境界を求めないので、従来どおり部分一致になる
+ALTER TABLE muted_words ADD COLUMN pattern TEXT GENERATED ALWAYS AS (
+    CASE WHEN word ~ '^[A-Za-z0-9_]' THEN '(^|[^A-Za-z0-9_])' ELSE '' END
+    || regexp_replace(word, '([.+*?()|\[\]{}^$\\])', '\\\1', 'g')
+    || CASE WHEN word ~ '[A-Za-z0-9_]$' THEN '($|[^A-Za-z0-9_])' ELSE '' END
+) STORED;
@@ -0,0 +1,113 @@
+package activitypub
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	requestTimeout = 10 * time.Second
+	// 取得する actor ドキュメントの大きさの上限
+	maxDocumentSize = 1 << 20
+)
+
+// StatusError は相手のサーバーが 2xx 以外を返したときのエラー
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("remote server responded with %d", e.StatusCode)
+}
+
+// Retryable は再試行すれば成功する見込みがあるか。4xx は 408・429 以外はやり直しても同じ
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests
+}
+
+// RemoteActor は他のサーバーの actor ドキュメントのうち、配信と署名の検証に使う項目
+type RemoteActor struct {
+	ID        string    `json:"id"`
+	Inbox     string    `json:"inbox"`
+	PublicKey PublicKey `json:"publicKey"`
+	Endpoints struct {
+		SharedInbox string `json:"sharedInbox"`
+	} `json:"endpoints"`
+}
+
+// Client は他のサーバーへの配信と actor ドキュメントの取得を行う。リクエストには全て署名する
+type Client struct {
+	http *http.Client
+}
+
+// NewClient は httpClient で通信する Client を作る。httpClient は SSRF 対策をしたものを渡す
+func NewClient(httpClient *http.Client) *Client {
+	return &Client{http: httpClient}
+}
+
+// Deliver は activity を inbox に POST する
+func (c *Client) Deliver(ctx context.Context, inbox string, activity []byte, keyID string, key *rsa.PrivateKey) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, inbox, bytes.NewReader(activity))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentType)
+	if err := Sign(req, activity, keyID, key); err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDocumentSize))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// FetchActor は uri の actor ドキュメントを取得する。署名を求めるサーバー（authorized fetch）のために GET にも署名する
+func (c *Client) FetchActor(ctx context.Context, uri, keyID string, key *rsa.PrivateKey) (*RemoteActor, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", ContentType)
+	if err := Sign(req, nil, keyID, key); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	var actor RemoteActor
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(&actor); err != nil {
+		return nil, err
+	}
+	if actor.ID == "" || actor.Inbox == "" || actor.PublicKey.PublicKeyPEM == "" {
+		return nil, fmt.Errorf("actor %s lacks id, inbox or publicKey", uri)
+	}
+	return &actor, nil
+}
@@ -0,0 +1,192 @@
+package activitypub
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 署名の Date ヘッダーと受け取った時刻のずれの上限（Mastodon と同じ）
+const maxClockSkew = 12 * time.Hour
+
+// GenerateKey は actor の RSA 鍵を作り、公開鍵・秘密鍵を PEM で返す
+func GenerateKey() (publicPEM, privatePEM string, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", err
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+	priv, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	publicPEM = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))
+	privatePEM = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: priv}))
+	return publicPEM, privatePEM, nil
+}
+
+func ParsePrivateKey(s string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("invalid private key pem")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not rsa")
+	}
+	return rsaKey, nil
+}
+
+// ParsePublicKey は actor ドキュメントの publicKeyPem を読む。PKIX と PKCS#1 のどちらも受け付ける
+func ParsePublicKey(s string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("invalid public key pem")
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not rsa")
+	}
+	return rsaKey, nil
+}
+
+// Sign は req に HTTP Signatures（draft-cavage-http-signatures、rsa-sha256）で署名する
+// body があれば Digest ヘッダーを付けて署名に含める
+func Sign(req *http.Request, body []byte, keyID string, key *rsa.PrivateKey) error {
+	if req.Header.Get("Date") == "" {
+		req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+	headers := []string{"(request-target)", "host", "date"}
+	if body != nil {
+		req.Header.Set("Digest", digest(body))
+		headers = append(headers, "digest")
+	}
+
+	hashed := sha256.Sum256([]byte(signingString(req, headers)))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(sig)))
+	return nil
+}
+
+// Verify は受け取った req の署名を確かめ、署名した鍵の keyId を返す
+// 公開鍵は fetchKey で keyId から取得する。(request-target)・host・date（body があれば digest も）が署名されていなければ受け付けない
+func Verify(req *http.Request, body []byte, fetchKey func(ctx context.Context, keyID string) (*rsa.PublicKey, error)) (string, error) {
+	params := parseSignature(req.Header.Get("Signature"))
+	keyID, sigB64 := params["keyId"], params["signature"]
+	if keyID == "" || sigB64 == "" {
+		return "", errors.New("missing signature")
+	}
+	// hs2019 は鍵の種類から決めるので、RSA の鍵なら rsa-sha256 として扱う
+	if alg := params["algorithm"]; alg != "" && alg != "rsa-sha256" && alg != "hs2019" {
+		return "", fmt.Errorf("unsupported signature algorithm %q", alg)
+	}
+
+	headers := strings.Fields(strings.ToLower(params["headers"]))
+	if len(headers) == 0 {
+		headers = []string{"date"}
+	}
+	required := []string{"(request-target)", "host", "date"}
+	if len(body) > 0 {
+		required = append(required, "digest")
+	}
+	for _, h := range required {
+		if !slices.Contains(headers, h) {
+			return "", fmt.Errorf("%s is not signed", h)
+		}
+	}
+
+	date, err := http.ParseTime(req.Header.Get("Date"))
+	if err != nil {
+		return "", errors.New("invalid date header")
+	}
+	if d := time.Since(date); d > maxClockSkew || d < -maxClockSkew {
+		return "", errors.New("date header is out of range")
+	}
+	if len(body) > 0 && req.Header.Get("Digest") != digest(body) {
+		return "", errors.New("digest does not match body")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(sigB64)
+	if err != nil {
+		return "", errors.New("invalid signature encoding")
+	}
+	key, err := fetchKey(req.Context(), keyID)
+	if err != nil {
+		return "", fmt.Errorf("fetch key %s: %w", keyID, err)
+	}
+
+	hashed := sha256.Sum256([]byte(signingString(req, headers)))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig); err != nil {
+		return "", errors.New("signature does not match")
+	}
+	return keyID, nil
+}
+
+func digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// signingString は headers の順に「名前: 値」を改行でつないだ署名対象の文字列
+func signingString(req *http.Request, headers []string) string {
+	lines := make([]string, len(headers))
+	for i, h := range headers {
+		var value string
+		switch h {
+		case "(request-target)":
+			value = strings.ToLower(req.Method) + " " + req.URL.RequestURI()
+		case "host":
+			value = req.Host
+			if value == "" {
+				value = req.URL.Host
+			}
+		default:
+			value = strings.Join(req.Header.Values(h), ", ")
+		}
+		lines[i] = h + ": " + value
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseSignature は Signature ヘッダーの key="value" をカンマで区切って読む
+func parseSignature(header string) map[string]string {
+	params := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		params[k] = strings.Trim(v, `"`)
+	}
+	return params
+}
@@ -0,0 +1,102 @@
+package activitypub
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKeyID = "https://remote.example/actor#main-key"
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	_, privatePEM, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParsePrivateKey(privatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// newSignedRequest は inbox への POST を作って署名する。date が空でなければ Date ヘッダーに使う
+func newSignedRequest(t *testing.T, key *rsa.PrivateKey, body []byte, date string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "https://local.example/ap/users/1/inbox", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", ContentType)
+	if date != "" {
+		req.Header.Set("Date", date)
+	}
+	if err := Sign(req, body, testKeyID, key); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestSignVerify(t *testing.T) {
+	key := newTestKey(t)
+	fetchKey := func(ctx context.Context, keyID string) (*rsa.PublicKey, error) {
+		if keyID != testKeyID {
+			t.Errorf("fetchKey called with %q", keyID)
+		}
+		return &key.PublicKey, nil
+	}
+	body := []byte(`{"type":"Follow","actor":"https://remote.example/actor"}`)
+
+	t.Run("valid", func(t *testing.T) {
+		req := newSignedRequest(t, key, body, "")
+		keyID, err := Verify(req, body, fetchKey)
+		if err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+		if keyID != testKeyID {
+			t.Errorf("keyID = %q, want %q", keyID, testKeyID)
+		}
+	})
+
+	t.Run("tampered body", func(t *testing.T) {
+		req := newSignedRequest(t, key, body, "")
+		tampered := bytes.Replace(body, []byte("Follow"), []byte("Block"), 1)
+		_, err := Verify(req, tampered, fetchKey)
+		if err == nil || !strings.Contains(err.Error(), "digest does not match") {
+			t.Fatalf("Verify error = %v, want digest mismatch", err)
+		}
+	})
+
+	t.Run("tampered digest", func(t *testing.T) {
+		// Digest ごと差し替えても、署名が Digest を含むので通らない
+		req := newSignedRequest(t, key, body, "")
+		tampered := bytes.Replace(body, []byte("Follow"), []byte("Block"), 1)
+		req.Header.Set("Digest", digest(tampered))
+		_, err := Verify(req, tampered, fetchKey)
+		if err == nil || !strings.Contains(err.Error(), "signature does not match") {
+			t.Fatalf("Verify error = %v, want signature mismatch", err)
+		}
+	})
+
+	t.Run("stale date", func(t *testing.T) {
+		stale := time.Now().Add(-maxClockSkew - time.Hour).UTC().Format(http.TimeFormat)
+		req := newSignedRequest(t, key, body, stale)
+		_, err := Verify(req, body, fetchKey)
+		if err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Fatalf("Verify error = %v, want date out of range", err)
+		}
+	})
+
+	t.Run("other key", func(t *testing.T) {
+		other := newTestKey(t)
+		req := newSignedRequest(t, other, body, "")
+		if _, err := Verify(req, body, fetchKey); err == nil {
+			t.Fatal("Verify accepted a signature made with another key")
+		}
+	})
+}
@@ -0,0 +1,207 @@
+package activitypub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+)
+
+const (
+	// ContentType は ActivityPub のドキュメントを返すときの Content-Type
+	ContentType = "application/activity+json"
+	// Public は誰でも見られる投稿の宛先
+	Public = "https://www.w3.org/ns/activitystreams#Public"
+)
+
+// defaultContext は actor ドキュメントに付ける @context。publicKey は security の語彙
+var defaultContext = []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"}
+
+const activityStreamsContext = "https://www.w3.org/ns/activitystreams"
+
+type Actor struct {
+	Context           any       `json:"@context"`
+	ID                string    `json:"id"`
+	Type              string    `json:"type"`
+	PreferredUsername string    `json:"preferredUsername"`
+	Name              string    `json:"name"`
+	Inbox             string    `json:"inbox"`
+	Outbox            string    `json:"outbox"`
+	Followers         string    `json:"followers"`
+	Published         time.Time `json:"published"`
+	PublicKey         PublicKey `json:"publicKey"`
+}
+
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPEM string `json:"publicKeyPem"`
+}
+
+type Note struct {
+	Context      any        `json:"@context,omitempty"`
+	ID           string     `json:"id"`
+	Type         string     `json:"type"`
+	AttributedTo string     `json:"attributedTo"`
+	Content      string     `json:"content"`
+	Published    time.Time  `json:"published"`
+	To           []string   `json:"to"`
+	Cc           []string   `json:"cc"`
+	Attachment   []Document `json:"attachment,omitempty"`
+}
+
+// Document はノートに添付する画像
+type Document struct {
+	Type      string `json:"type"`
+	MediaType string `json:"mediaType"`
+	URL       string `json:"url"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+}
+
+type Activity struct {
+	Context   any        `json:"@context,omitempty"`
+	ID        string     `json:"id"`
+	Type      string     `json:"type"`
+	Actor     string     `json:"actor"`
+	Published *time.Time `json:"published,omitempty"`
+	To        []string   `json:"to,omitempty"`
+	Cc        []string   `json:"cc,omitempty"`
+	Object    any        `json:"object"`
+}
+
+type OrderedCollection struct {
+	Context    any    `json:"@context"`
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	TotalItems int64  `json:"totalItems"`
+	First      string `json:"first,omitempty"`
+}
+
+type OrderedCollectionPage struct {
+	Context      any    `json:"@context"`
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	PartOf       string `json:"partOf"`
+	Next         string `json:"next,omitempty"`
+	OrderedItems []any  `json:"orderedItems"`
+}
+
+// IncomingActivity は inbox に届いたアクティビティ。Object は ID の文字列か埋め込まれたオブジェクト
+type IncomingActivity struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Actor  string          `json:"actor"`
+	Object json.RawMessage `json:"object"`
+}
+
+// ObjectID は Object の ID を返す。文字列ならそのまま、オブジェクトなら id を返す
+func (a IncomingActivity) ObjectID() string {
+	var id string
+	if err := json.Unmarshal(a.Object, &id); err == nil {
+		return id
+	}
+	var obj struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(a.Object, &obj)
+	return obj.ID
+}
+
+// WebFinger は /.well-known/webfinger のレスポンス（JRD）
+type WebFinger struct {
+	Subject string          `json:"subject"`
+	Aliases []string        `json:"aliases,omitempty"`
+	Links   []WebFingerLink `json:"links"`
+}
+
+type WebFingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type,omitempty"`
+	Href string `json:"href"`
+}
+
+// URLs は baseURL 以下の ActivityPub のオブジェクトの ID を作る。ID はそのまま取得できる URL
+type URLs struct {
+	Base string
+}
+
+func (u URLs) Actor(userID string) string     { return u.Base + "/ap/users/" + userID }
+func (u URLs) Key(userID string) string       { return u.Actor(userID) + "#main-key" }
+func (u URLs) Inbox(userID string) string     { return u.Actor(userID) + "/inbox" }
+func (u URLs) Outbox(userID string) string    { return u.Actor(userID) + "/outbox" }
+func (u URLs) Followers(userID string) string { return u.Actor(userID) + "/followers" }
+func (u URLs) Note(tweetID string) string     { return u.Base + "/ap/tweets/" + tweetID }
+
+// ActorOf はユーザーの actor ドキュメントを作る
+func (u URLs) ActorOf(user domain.User, publicKeyPEM string) Actor {
+	return Actor{
+		Context:           defaultContext,
+		ID:                u.Actor(user.ID),
+		Type:              "Person",
+		PreferredUsername: user.Name,
+		Name:              user.Name,
+		Inbox:             u.Inbox(user.ID),
+		Outbox:            u.Outbox(user.ID),
+		Followers:         u.Followers(user.ID),
+		Published:         user.CreatedAt,
+		PublicKey: PublicKey{
+			ID:           u.Key(user.ID),
+			Owner:        u.Actor(user.ID),
+			PublicKeyPEM: publicKeyPEM,
+		},
+	}
+}
+
+// NoteOf はツイートを公開の Note にする。宛先は Public、cc はフォロワー
+func (u URLs) NoteOf(t domain.TweetWithUser) Note {
+	note := Note{
+		ID:           u.Note(t.ID),
+		Type:         "Note",
+		AttributedTo: u.Actor(t.UserID),
+		Content:      "<p>" + strings.ReplaceAll(html.EscapeString(t.Content), "\n", "<br>") + "</p>",
+		Published:    t.CreatedAt,
+		To:           []string{Public},
+		Cc:           []string{u.Followers(t.UserID)},
+	}
+	for _, m := range t.Media {
+		note.Attachment = append(note.Attachment, Document{Type: "Document", MediaType: m.ContentType, URL: m.URL, Width: m.Width, Height: m.Height})
+	}
+	return note
+}
+
+// CreateOf はツイートを投稿したことを表す Create。ID は Note の ID から決まるので、何度作っても同じになる
+func (u URLs) CreateOf(t domain.TweetWithUser) Activity {
+	note := u.NoteOf(t)
+	return Activity{
+		Context:   activityStreamsContext,
+		ID:        note.ID + "/activity",
+		Type:      "Create",
+		Actor:     note.AttributedTo,
+		Published: &note.Published,
+		To:        note.To,
+		Cc:        note.Cc,
+		Object:    note,
+	}
+}
+
+// AcceptOf は userID が受け取った Follow を承認する Accept。ID は Follow の ID から決まる
+func (u URLs) AcceptOf(userID string, follow IncomingActivity) Activity {
+	sum := sha256.Sum256([]byte(follow.ID))
+	return Activity{
+		Context: activityStreamsContext,
+		ID:      u.Actor(userID) + "#accepts/" + hex.EncodeToString(sum[:16]),
+		Type:    "Accept",
+		Actor:   u.Actor(userID),
+		Object: Activity{
+			ID:     follow.ID,
+			Type:   follow.Type,
+			Actor:  follow.Actor,
+			Object: follow.ObjectID(),
+		},
+	}
+}
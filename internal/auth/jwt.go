@@ -79,3 +79,19 @@ func Middleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// OptionalMiddleware は Authorization ヘッダーのトークンが有効ならユーザーIDを context に載せる
+// ヘッダーがない・トークンが無効（期限切れなど）の場合は未ログインとしてそのまま通す
+// 古いトークンを持ったままのクライアントでも公開の情報は読めるようにするため、401 にはしない
+func OptionalMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := ValidateToken(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), UserIDKey, userID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,20 @@
+package backoff
+
+import "time"
+
+// Exponential は失敗するたびに倍々に延ばす再試行の間隔
+type Exponential struct {
+	// 1回目の失敗の後に待つ時間
+	Base time.Duration
+	// 待ち時間の上限
+	Max time.Duration
+}
+
+// Delay は attempts 回目の失敗の後に待つ時間
+func (e Exponential) Delay(attempts int) time.Duration {
+	delay := e.Base
+	for i := 1; i < attempts && delay < e.Max; i++ {
+		delay *= 2
+	}
+	return min(delay, e.Max)
+}
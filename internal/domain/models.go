@@ -1,16 +1,67 @@
 package domain
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // ============================================
 // Domain Models
 // ============================================
 
 type User struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	FollowersCount int64     `json:"followers_count"`
+	FolloweesCount int64     `json:"followees_count"`
+	TweetsCount    int64     `json:"tweets_count"`
+	Protected      bool      `json:"protected"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// ログイン中のリクエストでのみ埋める、閲覧者から見た関係
+	Relationship *Relationship `json:"relationship,omitempty"`
+	// プロフィール（GET /users/{id}, GET /users/me）でのみ埋める固定ツイート
+	PinnedTweet *TweetWithUser `json:"pinned_tweet,omitempty"`
+	// 本人向けのレスポンス（GET/PATCH /users/me）でのみ埋める設定
+	Settings *UserSettings `json:"settings,omitempty"`
+}
+
+// UserSettings は本人にしか見せない設定
+// DMFolloweesOnly が true なら自分がフォローしている人からしか DM を受け取らない
+type UserSettings struct {
+	DMFolloweesOnly bool `json:"dm_followees_only"`
+}
+
+// Relationship は閲覧者（viewer）から見た UserID のユーザーとの関係
+// FollowRequested は閲覧者がこのユーザー（鍵アカウント）に承認待ちのフォローリクエストを送っていること
+type Relationship struct {
+	UserID          string `json:"user_id"`
+	Following       bool   `json:"following"`
+	FollowedBy      bool   `json:"followed_by"`
+	Blocking        bool   `json:"blocking"`
+	BlockedBy       bool   `json:"blocked_by"`
+	Muting          bool   `json:"muting"`
+	FollowRequested bool   `json:"follow_requested"`
+}
+
+// MutedWord はホームフィードから隠すキーワード・ハッシュタグ
+// ExpiresAt が nil なら無期限
+type MutedWord struct {
+	ID        string     `json:"id"`
+	Word      string     `json:"word"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Suggestion はおすすめユーザー
+// MutualCount は閲覧者のフォロー中ユーザーのうち、User をフォローしている人数
+// FollowedBy はそのうちの1人（「X さん他 N 人がフォロー」の X）
+type Suggestion struct {
+	User        User   `json:"user"`
+	MutualCount int64  `json:"mutual_count"`
+	FollowedBy  User   `json:"followed_by"`
+	Reason      string `json:"reason"`
 }
 
 type UserAuth struct {
@@ -27,6 +78,37 @@ type Tweet struct {
 	LikesCount int64     `json:"likes_count"`
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
+	Poll       *Poll     `json:"poll,omitempty"`
+	Media      []Media   `json:"media,omitempty"`
+}
+
+// Media はアップロードされた画像。URL・ThumbnailURL はストレージの公開 URL
+type Media struct {
+	ID           string    `json:"id"`
+	ContentType  string    `json:"content_type"`
+	SizeBytes    int64     `json:"size_bytes"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Poll はツイートに付いた投票
+// VotedOption は閲覧者が投票した選択肢の Position（未投票・未ログインなら nil）
+type Poll struct {
+	Options     []PollOption `json:"options"`
+	ClosesAt    time.Time    `json:"closes_at"`
+	Closed      bool         `json:"closed"`
+	TotalVotes  int64        `json:"total_votes"`
+	VotedOption *int         `json:"voted_option"`
+}
+
+// PollOption の VotesCount は閲覧者が投票済み・締め切り後・投稿者本人のときだけ埋める
+type PollOption struct {
+	Position   int    `json:"position"`
+	Label      string `json:"label"`
+	VotesCount *int64 `json:"votes_count,omitempty"`
 }
 
 type TweetWithUser struct {
@@ -37,6 +119,268 @@ type TweetWithUser struct {
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 	User       User      `json:"user"`
+	Bookmarked bool      `json:"bookmarked"`
+	Poll       *Poll     `json:"poll,omitempty"`
+	Media      []Media   `json:"media,omitempty"`
+	// プロフィールのタイムラインで先頭に出す固定ツイートのときだけ true
+	Pinned bool `json:"pinned,omitempty"`
+}
+
+// ScheduledTweet は PublishAt に公開される予約投稿。公開されると同じ内容の Tweet になり、予約は消える
+type ScheduledTweet struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Content   string    `json:"content"`
+	PublishAt time.Time `json:"publish_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Draft は投稿前の下書き。Content は投稿時まで検証しないので空でもよい
+type Draft struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// List はユーザーが作るリスト。Private なリストは持ち主にしか見えない
+type List struct {
+	ID          string    `json:"id"`
+	OwnerID     string    `json:"owner_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Private     bool      `json:"private"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Conversation は DM の会話。Group でなければ2人だけの1対1の会話
+// UnreadCount は閲覧者が既読にしていない、他のメンバーからのメッセージの数
+type Conversation struct {
+	ID            string               `json:"id"`
+	Group         bool                 `json:"group"`
+	Members       []ConversationMember `json:"members"`
+	LastMessage   *Message             `json:"last_message"`
+	UnreadCount   int64                `json:"unread_count"`
+	LastMessageAt time.Time            `json:"last_message_at"`
+	CreatedAt     time.Time            `json:"created_at"`
+}
+
+// ConversationMember は会話のメンバーと既読位置（既読表示用）
+type ConversationMember struct {
+	User              User       `json:"user"`
+	LastReadMessageID *string    `json:"last_read_message_id"`
+	LastReadAt        *time.Time `json:"last_read_at"`
+}
+
+type Message struct {
+	ID             string    `json:"id"`
+	ConversationID string    `json:"conversation_id"`
+	SenderID       string    `json:"sender_id"`
+	Content        string    `json:"content"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// TweetCreatedEvent は新しいツイートを API インスタンス間に知らせる NOTIFY のペイロード
+type TweetCreatedEvent struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+}
+
+// UserEvent は宛先のユーザーが決まっているリアルタイム配信のイベント（新しい通知・DM）
+// ID は Topic に応じて通知の ID またはメッセージの ID
+type UserEvent struct {
+	Topic   string   `json:"topic"`
+	ID      string   `json:"id"`
+	UserIDs []string `json:"user_ids"`
+}
+
+// リアルタイム配信（WebSocket）のトピック
+const (
+	TopicFeed          = "feed"
+	TopicNotifications = "notifications"
+	TopicMessages      = "messages"
+)
+
+// 通知の種類
+const (
+	NotificationFollow  = "follow"
+	NotificationMention = "mention"
+	NotificationLike    = "like"
+)
+
+// Notification は未読の間に同じ種類・同じツイートへのイベントをまとめた通知
+// Actors は新しい順に最大3人、ActorsCount はまとめられたアクターの総数
+// Summary は "alice and 4 others liked your tweet" のような表示用の文
+type Notification struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	TweetID     *string   `json:"tweet_id,omitempty"`
+	Actors      []User    `json:"actors"`
+	ActorsCount int64     `json:"actors_count"`
+	Summary     string    `json:"summary"`
+	Read        bool      `json:"read"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// outbox に書き込むドメインイベントの種類
+const (
+	EventTweetCreated  = "tweet.created"
+	EventTweetDeleted  = "tweet.deleted"
+	EventFollowCreated = "follow.created"
+	EventFollowDeleted = "follow.deleted"
+)
+
+// OutboxEvent は outbox から relay が購読者に配るイベント
+// AggregateID は変更されたもの（ツイート・フォローした側のユーザー）の ID で、Payload は種類ごとの JSON
+type OutboxEvent struct {
+	ID          string
+	Type        string
+	AggregateID string
+	Payload     json.RawMessage
+	CreatedAt   time.Time
+	Attempts    int
+	// 前の試行で処理し終えた購読者
+	Consumed []string
+}
+
+// TweetEventPayload は tweet.created / tweet.deleted のペイロード
+type TweetEventPayload struct {
+	TweetID string `json:"tweet_id"`
+	UserID  string `json:"user_id"`
+}
+
+// FollowEventPayload は follow.created / follow.deleted のペイロード
+type FollowEventPayload struct {
+	FollowerID string `json:"follower_id"`
+	FolloweeID string `json:"followee_id"`
+}
+
+// バックグラウンドジョブの状態。失敗して再試行を待つジョブは run_at を先にずらした queued
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead"
+)
+
+// Job はバックグラウンドジョブ。Payload は Kind ごとの引数の JSON
+// LockedUntil は running の間の可視性タイムアウトで、過ぎると他のワーカーが取り直す
+type Job struct {
+	ID          string          `json:"id"`
+	Queue       string          `json:"queue"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LockedUntil *time.Time      `json:"locked_until"`
+	LastError   *string         `json:"last_error"`
+	FinishedAt  *time.Time      `json:"finished_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// JobQueueStats はキューごとのジョブの件数
+// OldestQueuedAt は実行時刻を過ぎて待っているジョブのうち最も古い run_at（滞留の目安）
+type JobQueueStats struct {
+	Queue          string     `json:"queue"`
+	Queued         int64      `json:"queued"`
+	Running        int64      `json:"running"`
+	Succeeded      int64      `json:"succeeded"`
+	Dead           int64      `json:"dead"`
+	OldestQueuedAt *time.Time `json:"oldest_queued_at"`
+}
+
+// ActorKey は ActivityPub の actor の RSA 鍵（PEM）
+type ActorKey struct {
+	UserID        string
+	PublicKeyPEM  string
+	PrivateKeyPEM string
+}
+
+// RemoteFollower は他のサーバーからのフォロワー
+// SharedInboxURL があればサーバー単位でまとめて配信する
+type RemoteFollower struct {
+	UserID           string
+	ActorURI         string
+	InboxURL         string
+	SharedInboxURL   *string
+	FollowActivityID string
+	CreatedAt        time.Time
+}
+
+// Webhook で購読できるイベント。ping は送信先の確認用で、購読しなくても送れる
+const (
+	WebhookEventFollow  = "follow"
+	WebhookEventMention = "mention"
+	WebhookEventLike    = "like"
+	WebhookEventPing    = "ping"
+)
+
+// Webhook の配信の状態。dead は再試行の上限に達したもの（dead letter）
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryDead      = "dead"
+)
+
+// Webhook はユーザーが登録した HTTPS の送信先。Secret は作成時のレスポンスにだけ含める
+type Webhook struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery は1回のイベントの配信。Payload は送信する本文そのもの
+// NextAttemptAt は pending の間だけ返す
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	WebhookID      string          `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      *string         `json:"last_error"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// WebhookPayload は送信する本文。ID は配信の ID で、受信側の重複排除に使える
+type WebhookPayload struct {
+	ID        string           `json:"id"`
+	Event     string           `json:"event"`
+	CreatedAt time.Time        `json:"created_at"`
+	Data      WebhookEventData `json:"data"`
+}
+
+// WebhookEventData はイベントの内容。詳細は受信側が REST API で取得する
+type WebhookEventData struct {
+	UserID  string  `json:"user_id"`
+	ActorID string  `json:"actor_id,omitempty"`
+	TweetID *string `json:"tweet_id,omitempty"`
+}
+
+// PendingWebhookDelivery は送信のために取り出した配信。Attempts は今回の試行を含む回数
+type PendingWebhookDelivery struct {
+	ID       string
+	URL      string
+	Secret   string
+	Event    string
+	Payload  []byte
+	Attempts int
 }
 
 // ============================================
@@ -58,6 +402,12 @@ type SignupResponse struct {
 	Token string `json:"token"`
 }
 
+// UpdateMeRequest は PATCH /users/me のリクエスト。nil のフィールドは変更しない
+type UpdateMeRequest struct {
+	Protected       *bool `json:"protected"`
+	DMFolloweesOnly *bool `json:"dm_followees_only"`
+}
+
 type LoginRequest struct {
 	Name     string `json:"name"`
 	Password string `json:"password"`
@@ -68,10 +418,44 @@ type LoginResponse struct {
 	Token string `json:"token"`
 }
 
+// PostTweetRequest は PublishAt が指定されていれば予約投稿になる
 type PostTweetRequest struct {
+	Content   string             `json:"content"`
+	PublishAt *time.Time         `json:"publish_at"`
+	Poll      *CreatePollRequest `json:"poll"`
+	MediaIDs  []string           `json:"media_ids"`
+}
+
+type CreatePollRequest struct {
+	Options  []string  `json:"options"`
+	ClosesAt time.Time `json:"closes_at"`
+}
+
+type VotePollRequest struct {
+	Option *int `json:"option"`
+}
+
+type UpdateScheduledTweetRequest struct {
+	Content   *string    `json:"content"`
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+type DraftRequest struct {
 	Content string `json:"content"`
 }
 
+type GetDraftsResponse struct {
+	Drafts []Draft `json:"drafts"`
+}
+
+type GetScheduledTweetsResponse struct {
+	ScheduledTweets []ScheduledTweet `json:"scheduled_tweets"`
+}
+
+type PinTweetRequest struct {
+	TweetID string `json:"tweet_id"`
+}
+
 type PostTweetResponse struct {
 	ID         string    `json:"id"`
 	UserID     string    `json:"user_id"`
@@ -98,11 +482,143 @@ type GetTweetsResponse struct {
 	Pagination Pagination `json:"pagination"`
 }
 
+// Cursor はキーセットページネーションの位置（並び順のキーとなる日時 + タイブレーク用ID）
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+type CursorPagination struct {
+	Limit      int64   `json:"limit"`
+	NextCursor *string `json:"next_cursor"`
+}
+
 type GetUsersResponse struct {
-	Users []User `json:"users"`
+	Users      []User           `json:"users"`
+	Pagination CursorPagination `json:"pagination"`
+}
+
+type CreateMutedWordRequest struct {
+	Word      string     `json:"word"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type GetMutedWordsResponse struct {
+	MutedWords []MutedWord `json:"muted_words"`
+}
+
+type CreateListRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Private     bool   `json:"private"`
+}
+
+// UpdateListRequest は PATCH /lists/{id} のリクエスト。nil のフィールドは変更しない
+type UpdateListRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Private     *bool   `json:"private"`
+}
+
+type GetListsResponse struct {
+	Lists []List `json:"lists"`
+}
+
+type GetSuggestionsResponse struct {
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+type GetRelationshipsResponse struct {
+	Relationships []Relationship `json:"relationships"`
 }
 
 type GetFeedResponse struct {
 	Tweets     []TweetWithUser `json:"tweets"`
 	Pagination Pagination      `json:"pagination"`
 }
+
+type GetUserTweetsResponse struct {
+	Tweets     []TweetWithUser  `json:"tweets"`
+	Pagination CursorPagination `json:"pagination"`
+}
+
+type GetBookmarksResponse struct {
+	Tweets     []TweetWithUser  `json:"tweets"`
+	Pagination CursorPagination `json:"pagination"`
+}
+
+type GetNotificationsResponse struct {
+	Notifications []Notification   `json:"notifications"`
+	UnreadCount   int64            `json:"unread_count"`
+	Pagination    CursorPagination `json:"pagination"`
+}
+
+type GetUnreadNotificationsCountResponse struct {
+	UnreadCount int64 `json:"unread_count"`
+}
+
+// MarkNotificationsReadRequest は IDs が空なら全ての未読通知を既読にする
+type MarkNotificationsReadRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// CreateConversationRequest は自分以外のメンバーを指定する。1人なら1対1、2人以上ならグループの会話になる
+type CreateConversationRequest struct {
+	UserIDs []string `json:"user_ids"`
+}
+
+type GetConversationsResponse struct {
+	Conversations []Conversation   `json:"conversations"`
+	Pagination    CursorPagination `json:"pagination"`
+}
+
+type SendMessageRequest struct {
+	Content string `json:"content"`
+}
+
+type GetMessagesResponse struct {
+	Messages   []Message        `json:"messages"`
+	Pagination CursorPagination `json:"pagination"`
+}
+
+// MarkConversationReadRequest は MessageID が nil なら最新のメッセージまで既読にする
+type MarkConversationReadRequest struct {
+	MessageID *string `json:"message_id"`
+}
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// UpdateWebhookRequest は nil のフィールドを変更しない
+type UpdateWebhookRequest struct {
+	URL    *string  `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+type GetWebhooksResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+type GetWebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Pagination CursorPagination  `json:"pagination"`
+}
+
+// EnqueueJobRequest は管理 API からジョブを積むリクエスト。RunAt が nil なら今すぐ実行する
+type EnqueueJobRequest struct {
+	Kind    string          `json:"kind"`
+	Payload json.RawMessage `json:"payload"`
+	RunAt   *time.Time      `json:"run_at"`
+}
+
+type GetJobQueuesResponse struct {
+	Queues []JobQueueStats `json:"queues"`
+}
+
+type GetJobsResponse struct {
+	Jobs       []Job            `json:"jobs"`
+	Pagination CursorPagination `json:"pagination"`
+}
@@ -0,0 +1,278 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/backoff"
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/Tetsu-is/social-media-scaling/internal/repository"
+	"github.com/google/uuid"
+)
+
+const (
+	// 取り出せるジョブがないときに次に見に行くまでの時間。NOTIFY で起こされればすぐに見に行く
+	pollInterval = 2 * time.Second
+	// 成功したジョブを残しておく期間と、掃除の間隔
+	retention     = 7 * 24 * time.Hour
+	pruneInterval = time.Hour
+	// Kind で MaxAttempts を指定しなかったときの試行回数
+	defaultMaxAttempts = 5
+	// 可視性タイムアウトは実行の上限にこれを足したもの。タイムアウトしたジョブの結果を記録し終えるまで他のワーカーに渡さない
+	visibilityMargin = 30 * time.Second
+)
+
+// retryBackoff は失敗したジョブを次に実行するまでの間隔。MaxAttempts 回失敗すると dead になる
+var retryBackoff = backoff.Exponential{Base: 10 * time.Second, Max: time.Hour}
+
+// ErrUnknownKind は登録されていない種類のジョブを積もうとしたときのエラー
+var ErrUnknownKind = errors.New("unknown job kind")
+
+// Kind は引数の型が T のジョブの種類。Register でハンドラを登録し、Enqueue で積む
+type Kind[T any] struct {
+	Name  string
+	Queue string
+	// 0 なら defaultMaxAttempts
+	MaxAttempts int
+}
+
+// permanentError はこれ以上やり直しても成功しない失敗
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent はハンドラが返すエラーを包み、残りの試行回数に関係なくジョブを dead にさせる
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+type handler struct {
+	queue       string
+	maxAttempts int
+	run         func(ctx context.Context, payload []byte) error
+	validate    func(payload []byte) error
+}
+
+type queueConfig struct {
+	concurrency int
+	timeout     time.Duration
+	wake        chan struct{}
+}
+
+// Worker はキューごとに決めた数の goroutine でジョブを取り出して実行する
+// 全インスタンスで Run してよい。ジョブは SKIP LOCKED で取り合うので、可視性タイムアウトまでは1台でしか実行されない
+// 同時実行数はインスタンスごとの上限で、全体では「インスタンス数 × concurrency」になる
+type Worker struct {
+	repo *repository.JobRepository
+
+	queues   map[string]*queueConfig
+	handlers map[string]handler
+}
+
+func NewWorker(repo *repository.JobRepository) *Worker {
+	return &Worker{repo: repo, queues: make(map[string]*queueConfig), handlers: make(map[string]handler)}
+}
+
+// Queue はキューを用意する。Register・Run の前に呼ぶ
+// concurrency は同時に実行するジョブの数、timeout は1回の実行の上限
+// 実行中にワーカーが落ちたジョブは timeout + visibilityMargin 後に他のワーカーが取り直す
+func (w *Worker) Queue(name string, concurrency int, timeout time.Duration) {
+	w.queues[name] = &queueConfig{concurrency: concurrency, timeout: timeout, wake: make(chan struct{}, concurrency)}
+}
+
+// Register は kind のハンドラを登録する。Run の前に呼ぶ
+// 引数の JSON を T に読めないジョブはやり直しても成功しないので dead にする
+func Register[T any](w *Worker, kind Kind[T], fn func(ctx context.Context, args T) error) {
+	if _, ok := w.queues[kind.Queue]; !ok {
+		panic(fmt.Sprintf("jobs: queue %q is not configured for kind %q", kind.Queue, kind.Name))
+	}
+	maxAttempts := kind.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	w.handlers[kind.Name] = handler{
+		queue:       kind.Queue,
+		maxAttempts: maxAttempts,
+		run: func(ctx context.Context, payload []byte) error {
+			var args T
+			if err := json.Unmarshal(payload, &args); err != nil {
+				return Permanent(fmt.Errorf("invalid payload: %w", err))
+			}
+			return fn(ctx, args)
+		},
+		validate: func(payload []byte) error {
+			var args T
+			return json.Unmarshal(payload, &args)
+		},
+	}
+}
+
+// Enqueue は kind のジョブを積む。runAt がゼロ値なら今すぐ実行する
+func Enqueue[T any](ctx context.Context, w *Worker, kind Kind[T], args T, runAt time.Time) (*domain.Job, error) {
+	payload, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	return w.EnqueueRaw(ctx, kind.Name, payload, runAt)
+}
+
+// EnqueueRaw は種類の名前と JSON の引数でジョブを積む（管理 API 用）
+// 登録されていない種類なら ErrUnknownKind を、引数を読めなければそのエラーを返す
+func (w *Worker) EnqueueRaw(ctx context.Context, kind string, payload []byte, runAt time.Time) (*domain.Job, error) {
+	h, ok := w.handlers[kind]
+	if !ok {
+		return nil, ErrUnknownKind
+	}
+	if err := h.validate(payload); err != nil {
+		return nil, err
+	}
+	if runAt.IsZero() {
+		runAt = time.Now()
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+	return w.repo.Enqueue(ctx, id.String(), h.queue, kind, payload, runAt, h.maxAttempts)
+}
+
+// Wake は Listener に JobsChannel のハンドラとして登録し、積まれたジョブをポーリングを待たずに実行する
+func (w *Worker) Wake(ctx context.Context, queue string) {
+	q, ok := w.queues[queue]
+	if !ok {
+		return
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run は ctx がキャンセルされるまでジョブを実行する
+// キャンセル後は新しいジョブを取り出さず、実行中のジョブが終わる（timeout まで）のを待ってから戻る
+func (w *Worker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for name, q := range w.queues {
+		kinds := w.kindsOf(name)
+		if len(kinds) == 0 {
+			continue
+		}
+		for range q.concurrency {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w.poll(ctx, name, q, kinds)
+			}()
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.prune(ctx)
+	}()
+
+	wg.Wait()
+}
+
+func (w *Worker) kindsOf(queue string) []string {
+	var kinds []string
+	for name, h := range w.handlers {
+		if h.queue == queue {
+			kinds = append(kinds, name)
+		}
+	}
+	return kinds
+}
+
+// poll は1つの実行枠。ジョブがある間は続けて実行し、なくなったら起こされるか pollInterval が経つまで待つ
+func (w *Worker) poll(ctx context.Context, queue string, q *queueConfig, kinds []string) {
+	for ctx.Err() == nil {
+		job, err := w.repo.Claim(ctx, queue, kinds, q.timeout+visibilityMargin)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("failed to claim job from %s: %v", queue, err)
+			}
+		} else if job != nil {
+			w.execute(job, q.timeout)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-q.wake:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// execute はジョブを実行して結果を記録する
+// シャットダウン中でも実行中のジョブは最後まで走らせたいので、ctx は Run のものではなく timeout だけで切る
+func (w *Worker) execute(job *domain.Job, timeout time.Duration) {
+	h := w.handlers[job.Kind]
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	err := runHandler(ctx, h, job.Payload)
+	cancel()
+
+	// ハンドラの ctx はタイムアウトしているかもしれないので、記録には別の ctx を使う
+	recordCtx, cancelRecord := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelRecord()
+
+	if err == nil {
+		if err := w.repo.Complete(recordCtx, job.ID, job.Attempts); err != nil {
+			log.Printf("failed to record job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	var next *time.Time
+	var permanent permanentError
+	if job.Attempts < job.MaxAttempts && !errors.As(err, &permanent) {
+		at := time.Now().Add(retryBackoff.Delay(job.Attempts))
+		next = &at
+	}
+	log.Printf("job %s (%s) failed on attempt %d/%d: %v", job.ID, job.Kind, job.Attempts, job.MaxAttempts, err)
+
+	if err := w.repo.Fail(recordCtx, job.ID, job.Attempts, err.Error(), next); err != nil {
+		log.Printf("failed to record job %s: %v", job.ID, err)
+	}
+}
+
+// runHandler はハンドラの panic をエラーにする
+func runHandler(ctx context.Context, h handler, payload []byte) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return h.run(ctx, payload)
+}
+
+// prune は成功したジョブを retention を過ぎたら削除する
+func (w *Worker) prune(ctx context.Context) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := w.repo.DeleteSucceededBefore(ctx, time.Now().Add(-retention))
+			if err != nil {
+				log.Println("failed to prune jobs:", err)
+			} else if n > 0 {
+				log.Printf("pruned %d jobs", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// 1回の確認・ロック取得にかける時間の上限
+const queryTimeout = 3 * time.Second
+
+// Elector は Postgres のアドバイザリーロックで API インスタンスの中から1台だけリーダーを選ぶ
+// ロックはセッション単位なので、リーダーの間はプールから借りたコネクションを Hijack して持ち続ける
+// プロセスが落ちたりコネクションが切れたりすると Postgres がロックを外し、他のインスタンスが引き継ぐ
+type Elector struct {
+	pool     *pgxpool.Pool
+	name     string
+	key      int64
+	interval time.Duration
+
+	onElected []func(ctx context.Context)
+	onLost    []func()
+	leader    atomic.Bool
+}
+
+// NewElector は name のロックを取り合う Elector を作る。同じ name の Elector の中から1台がリーダーになる
+// interval ごとにロックの取得を試み、リーダーの間は interval ごとにロックを持っているか確かめる（リースの更新）
+func NewElector(pool *pgxpool.Pool, name string, interval time.Duration) *Elector {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return &Elector{pool: pool, name: name, key: int64(h.Sum64()), interval: interval}
+}
+
+// OnElected はリーダーになったときに実行する関数を登録する。Run の前に呼ぶ
+// fn は goroutine で実行し、ctx はリーダーでなくなるとキャンセルされる。fn が全て戻るまで次の選出には参加しない
+func (e *Elector) OnElected(fn func(ctx context.Context)) {
+	e.onElected = append(e.onElected, fn)
+}
+
+// OnLost はリーダーでなくなったとき（OnElected の関数が全て戻った後）に呼ぶ関数を登録する。Run の前に呼ぶ
+func (e *Elector) OnLost(fn func()) {
+	e.onLost = append(e.onLost, fn)
+}
+
+// IsLeader はこのインスタンスが今リーダーかどうかを返す
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run は ctx がキャンセルされるまで選出に参加する。キャンセルされたらリーダーを降りてロックを外してから戻る
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		conn, err := e.campaign(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("leader election %s failed: %v", e.name, err)
+		}
+		if conn != nil {
+			e.lead(ctx, conn)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// campaign はロックの取得を試み、取れたらロックを持っているコネクションを返す
+// 取れなかったコネクションはそのままプールに返す
+func (e *Elector) campaign(ctx context.Context) (*pgx.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	c, err := e.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var acquired bool
+	if err := c.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", e.key).Scan(&acquired); err != nil {
+		c.Release()
+		return nil, err
+	}
+	if !acquired {
+		c.Release()
+		return nil, nil
+	}
+
+	// プールに戻すと他のクエリがロックを持ったセッションを使い回すので、プールから切り離して持つ
+	return c.Hijack(), nil
+}
+
+// lead はリーダーとして OnElected の関数を動かし、ロックを失うか ctx がキャンセルされるまで interval ごとにロックを確かめる
+func (e *Elector) lead(ctx context.Context, conn *pgx.Conn) {
+	e.leader.Store(true)
+	log.Printf("became leader of %s", e.name)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for _, fn := range e.onElected {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(leaderCtx)
+		}()
+	}
+
+	ticker := time.NewTicker(e.interval)
+	for leaderCtx.Err() == nil {
+		select {
+		case <-leaderCtx.Done():
+		case <-ticker.C:
+			if err := e.renew(leaderCtx, conn); err != nil {
+				if ctx.Err() == nil {
+					log.Printf("lost leadership of %s: %v", e.name, err)
+				}
+				cancel()
+			}
+		}
+	}
+	ticker.Stop()
+	cancel()
+
+	// 前のリーダーの処理が残っている間に次のリーダーが動き出さないよう、処理が全て戻ってからロックを外す
+	wg.Wait()
+
+	// コネクションを閉じればセッションが終わってロックも外れる。切れていても閉じるだけなのでエラーは無視する
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), queryTimeout)
+	conn.Close(closeCtx)
+	cancelClose()
+
+	e.leader.Store(false)
+	for _, fn := range e.onLost {
+		fn()
+	}
+}
+
+// renew はコネクションが生きていて、まだロックを持っているか確かめる
+func (e *Elector) renew(ctx context.Context, conn *pgx.Conn) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	// bigint のキーは上位32ビットが classid、下位32ビットが objid、objsubid が 1 のロックになる
+	var held bool
+	err := conn.QueryRow(ctx,
+		`SELECT EXISTS(
+			SELECT 1 FROM pg_locks
+			WHERE locktype = 'advisory' AND classid = $1 AND objid = $2 AND objsubid = 1
+			  AND pid = pg_backend_pid() AND granted
+		 )`,
+		uint32(uint64(e.key)>>32), uint32(e.key),
+	).Scan(&held)
+	if err != nil {
+		return err
+	}
+	if !held {
+		return errors.New("advisory lock is no longer held")
+	}
+	return nil
+}
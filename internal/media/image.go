@@ -0,0 +1,144 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	// MaxSize はアップロードできる画像の最大バイト数
+	MaxSize = 5 << 20
+	// 縦横のどちらかが maxDimension を超える画像、総ピクセル数が maxPixels を超える画像はデコードせずに弾く
+	// 展開後のメモリ消費を抑えるため（40MP の RGBA で約160MB）
+	maxDimension = 8192
+	maxPixels    = 40_000_000
+	// thumbnailSize はサムネイルの長辺のピクセル数
+	thumbnailSize = 320
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported media type")
+	ErrTooLarge        = errors.New("media is too large")
+	ErrInvalidImage    = errors.New("invalid image")
+)
+
+// allowedTypes は受け付ける Content-Type と保存時の拡張子
+var allowedTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Image は検証済みの画像とそのサムネイル
+type Image struct {
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+	Thumbnail   []byte
+}
+
+// Process は data の種類とサイズを検証し、JPEG のサムネイルを作る
+// 種類はクライアントの申告ではなく先頭バイトから判定する
+func Process(data []byte) (*Image, error) {
+	if len(data) > MaxSize {
+		return nil, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := allowedTypes[contentType]
+	if !ok {
+		return nil, ErrUnsupportedType
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > maxDimension || cfg.Height > maxDimension ||
+		cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrInvalidImage
+	}
+
+	var src image.Image
+	switch contentType {
+	case "image/jpeg":
+		src, err = jpeg.Decode(bytes.NewReader(data))
+	case "image/png":
+		src, err = png.Decode(bytes.NewReader(data))
+	case "image/gif":
+		src, err = gif.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumbnail(src, thumbnailSize), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+
+	return &Image{
+		ContentType: contentType,
+		Ext:         ext,
+		Width:       cfg.Width,
+		Height:      cfg.Height,
+		Thumbnail:   buf.Bytes(),
+	}, nil
+}
+
+// thumbnail は長辺が size 以下になるよう縮小する（拡大はしない）
+// 縮小先の1ピクセルに対応する元画像の範囲を平均する。透過部分は白で塗る
+func thumbnail(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > size || h > size {
+		if w >= h {
+			h = max(1, h*size/w)
+			w = size
+		} else {
+			w = max(1, w*size/h)
+			h = size
+		}
+	}
+
+	// 元画像のコピーは作らず、src から直接読む。RGBA64At があれば At より割り当てが少ない
+	rgba := func(x, y int) (uint32, uint32, uint32, uint32) { return src.At(x, y).RGBA() }
+	if img, ok := src.(image.RGBA64Image); ok {
+		rgba = func(x, y int) (uint32, uint32, uint32, uint32) {
+			c := img.RGBA64At(x, y)
+			return uint32(c.R), uint32(c.G), uint32(c.B), uint32(c.A)
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := max(y0+1, b.Min.Y+(y+1)*b.Dy()/h)
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := max(x0+1, b.Min.X+(x+1)*b.Dx()/w)
+
+			var r, g, bl, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					// 値は alpha 乗算済みなので、白の上に重ねるには透けている分（0xffff - a）を足す
+					cr, cg, cb, ca := rgba(sx, sy)
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					bl += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(bl / n >> 8), A: 0xff})
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,144 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/backoff"
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/Tetsu-is/social-media-scaling/internal/repository"
+)
+
+const (
+	// 1回に取り出すイベントの数
+	claimBatchSize = 100
+	// 取り出したイベントを他のインスタンスに渡さない時間。購読者の処理はこの間に終える
+	claimLease = time.Minute
+	// 配信済みのイベントを残しておく期間と、掃除の間隔
+	retention     = 7 * 24 * time.Hour
+	pruneInterval = time.Hour
+)
+
+// retryBackoff は購読者が失敗したイベントを配り直すまでの間隔
+// outbox のイベントは諦めずに配り直し続けるので、上限を短めにして復旧後すぐに追いつけるようにする
+var retryBackoff = backoff.Exponential{Base: 5 * time.Second, Max: 10 * time.Minute}
+
+// Handler はイベントを処理する。エラーを返すと後で同じイベントがもう一度届く
+// 処理し終えた後に記録する前にプロセスが落ちた場合も届き直すので、何度処理しても同じ結果になるように書く
+type Handler func(ctx context.Context, event domain.OutboxEvent) error
+
+type subscriber struct {
+	name       string
+	eventTypes []string
+	handle     Handler
+}
+
+// Relay は outbox のイベントをプロセス内の購読者に少なくとも1回配る
+// 購読者は全インスタンスで同じものを登録する。各インスタンスが Run しても、1つのイベントは SKIP LOCKED で取り出せた1台だけが配る
+type Relay struct {
+	repo     *repository.OutboxRepository
+	interval time.Duration
+
+	subscribers []subscriber
+	wake        chan struct{}
+}
+
+func NewRelay(repo *repository.OutboxRepository, interval time.Duration) *Relay {
+	return &Relay{repo: repo, interval: interval, wake: make(chan struct{}, 1)}
+}
+
+// Subscribe は eventTypes のイベントを受け取る購読者を登録する。Run の前に呼ぶ
+// name は処理済みの記録に使うので、購読者ごとに一意で、デプロイをまたいで変えない
+func (r *Relay) Subscribe(name string, eventTypes []string, handle Handler) {
+	r.subscribers = append(r.subscribers, subscriber{name: name, eventTypes: eventTypes, handle: handle})
+}
+
+// Wake は Listener に OutboxChannel のハンドラとして登録し、書き込まれたイベントをポーリングを待たずに配る
+func (r *Relay) Wake(ctx context.Context, payload string) {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run は ctx がキャンセルされるまで interval ごと（または Wake されたとき）にイベントを配る
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	prune := time.NewTicker(pruneInterval)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.relayDue(ctx)
+		case <-r.wake:
+			r.relayDue(ctx)
+		case <-prune.C:
+			n, err := r.repo.DeletePublishedBefore(ctx, time.Now().Add(-retention))
+			if err != nil {
+				log.Println("failed to prune outbox:", err)
+			} else if n > 0 {
+				log.Printf("pruned %d outbox events", n)
+			}
+		}
+	}
+}
+
+// relayDue は配るべきイベントがなくなるまでバッチ単位で配る
+func (r *Relay) relayDue(ctx context.Context) {
+	for {
+		events, err := r.repo.ClaimDue(ctx, claimBatchSize, claimLease)
+		if err != nil {
+			log.Println("failed to claim outbox events:", err)
+			return
+		}
+
+		for _, event := range events {
+			r.dispatch(ctx, event)
+		}
+
+		if len(events) < claimBatchSize || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// dispatch はまだ処理し終えていない購読者にイベントを渡す
+// 全員が処理し終えたら配信済みにし、失敗した購読者がいれば待ってから失敗した購読者にだけ配り直す
+func (r *Relay) dispatch(ctx context.Context, event domain.OutboxEvent) {
+	var failures []string
+	for _, sub := range r.subscribers {
+		if !slices.Contains(sub.eventTypes, event.Type) || slices.Contains(event.Consumed, sub.name) {
+			continue
+		}
+
+		if err := sub.handle(ctx, event); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", sub.name, err))
+			continue
+		}
+		if err := r.repo.MarkConsumed(ctx, event.ID, sub.name); err != nil {
+			// 記録できなくても次の試行でもう一度処理されるだけなので、配信済みにはしない
+			failures = append(failures, fmt.Sprintf("%s: %v", sub.name, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		msg := strings.Join(failures, "; ")
+		log.Printf("outbox event %s (%s) failed on attempt %d: %s", event.ID, event.Type, event.Attempts, msg)
+		if err := r.repo.MarkFailed(ctx, event.ID, msg, time.Now().Add(retryBackoff.Delay(event.Attempts))); err != nil {
+			log.Println("failed to record outbox failure:", err)
+		}
+		return
+	}
+
+	if err := r.repo.MarkPublished(ctx, event.ID); err != nil {
+		log.Println("failed to mark outbox event as published:", err)
+	}
+}
@@ -0,0 +1,145 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/Tetsu-is/social-media-scaling/internal/repository"
+)
+
+// 1購読あたりの未送信ツイートIDのバッファ。溢れた購読は切断する
+const feedBufferSize = 256
+
+// FeedSubscription はログイン中のユーザーのフィードへの新着ツイートの購読
+type FeedSubscription struct {
+	userID string
+	events chan string
+	done   chan struct{}
+}
+
+// Events は新着ツイートの ID を受け取るチャンネル
+func (s *FeedSubscription) Events() <-chan string {
+	return s.events
+}
+
+// Done はバッファが溢れた・Listener が再接続したなどで購読が打ち切られたときに閉じる
+// 打ち切られた購読者は Last-Event-ID から取り直す
+func (s *FeedSubscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// FeedHub は TweetCreatedChannel の通知を、投稿者をフォローしている購読者に配る
+type FeedHub struct {
+	followRepo *repository.FollowRepository
+
+	mu     sync.Mutex
+	subs   map[string]map[*FeedSubscription]struct{}
+	closed bool
+}
+
+func NewFeedHub(followRepo *repository.FollowRepository) *FeedHub {
+	return &FeedHub{followRepo: followRepo, subs: make(map[string]map[*FeedSubscription]struct{})}
+}
+
+// Subscribe は userID のフィードを購読する。使い終わったら Unsubscribe する
+// Close の後は打ち切り済みの購読を返す
+func (h *FeedHub) Subscribe(userID string) *FeedSubscription {
+	sub := &FeedSubscription{
+		userID: userID,
+		events: make(chan string, feedBufferSize),
+		done:   make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(sub.done)
+		return sub
+	}
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[*FeedSubscription]struct{})
+	}
+	h.subs[userID][sub] = struct{}{}
+	return sub
+}
+
+func (h *FeedHub) Unsubscribe(sub *FeedSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(sub)
+}
+
+// HandleTweetCreated は Listener に登録するハンドラ
+// 接続中のユーザーのうち投稿者のフォロワーを1クエリで絞り込み、その購読だけにツイートIDを送る
+func (h *FeedHub) HandleTweetCreated(ctx context.Context, payload string) {
+	var event domain.TweetCreatedEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		log.Println("invalid tweet_created payload:", err)
+		return
+	}
+
+	h.mu.Lock()
+	userIDs := make([]string, 0, len(h.subs))
+	for userID := range h.subs {
+		userIDs = append(userIDs, userID)
+	}
+	h.mu.Unlock()
+	if len(userIDs) == 0 {
+		return
+	}
+
+	followers, err := h.followRepo.FilterFollowers(ctx, event.UserID, userIDs)
+	if err != nil {
+		log.Println("failed to fan out tweet:", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, userID := range followers {
+		for sub := range h.subs[userID] {
+			select {
+			case sub.events <- event.ID:
+			default:
+				// 読み出しが追いつかない購読は切断し、再接続時に Last-Event-ID から取り直させる
+				h.removeLocked(sub)
+				close(sub.done)
+			}
+		}
+	}
+}
+
+// EvictAll は全ての購読を打ち切る。Listener の再接続で通知を取りこぼした可能性があるときに使う
+func (h *FeedHub) EvictAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, subs := range h.subs {
+		for sub := range subs {
+			h.removeLocked(sub)
+			close(sub.done)
+		}
+	}
+}
+
+// Close はサーバーの終了時に全ての購読を打ち切り、以降の購読も受け付けない
+// SSE の接続はこれで終わり、クライアントは別のインスタンスに Last-Event-ID で再接続する
+func (h *FeedHub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+	h.EvictAll()
+}
+
+func (h *FeedHub) removeLocked(sub *FeedSubscription) {
+	subs := h.subs[sub.userID]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subs, sub.userID)
+	}
+}
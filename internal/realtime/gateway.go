@@ -0,0 +1,397 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// 1接続あたりの未送信メッセージのバッファ。溢れたら遅いクライアントとして切断する
+	wsSendBufferSize = 64
+	wsWriteTimeout   = 10 * time.Second
+	wsPingInterval   = 30 * time.Second
+	// この間にクライアントから何も届かなければ（pong を含む）切断する
+	wsReadTimeout = 60 * time.Second
+	// close フレームを送ってからクライアントの close を待つ時間
+	wsCloseGracePeriod = 5 * time.Second
+	wsMaxMessageSize   = 4096
+)
+
+// Resolver はイベントをクライアントに送る data に変換する
+// 閲覧者に見せないイベント（削除済み・ブロックなど）は nil を返す
+type Resolver func(ctx context.Context, userID string, event Event) (any, error)
+
+// clientMessage はクライアントから送られるメッセージ
+// type は subscribe / unsubscribe / ping
+type clientMessage struct {
+	Type   string   `json:"type"`
+	Topics []string `json:"topics"`
+}
+
+// serverMessage はクライアントに送るメッセージ
+// type は subscribed / event / pong / error
+type serverMessage struct {
+	Type    string   `json:"type"`
+	Topic   string   `json:"topic,omitempty"`
+	Topics  []string `json:"topics,omitempty"`
+	Data    any      `json:"data,omitempty"`
+	Message string   `json:"message,omitempty"`
+}
+
+// Gateway は1本の WebSocket で通知・DM・フィードのイベントを配る
+// 接続は http.Server から切り離される（hijack）ので、終了時の待ち合わせは Shutdown で行う
+type Gateway struct {
+	feedHub  *FeedHub
+	userHub  *UserHub
+	resolve  Resolver
+	upgrader websocket.Upgrader
+
+	mu      sync.Mutex
+	conns   map[*wsConn]struct{}
+	closing bool
+	wg      sync.WaitGroup
+}
+
+// NewGateway は allowedOrigins（と同一オリジン）からの接続だけを受け付ける Gateway を作る
+func NewGateway(feedHub *FeedHub, userHub *UserHub, resolve Resolver, allowedOrigins []string) *Gateway {
+	g := &Gateway{
+		feedHub: feedHub,
+		userHub: userHub,
+		resolve: resolve,
+		conns:   make(map[*wsConn]struct{}),
+	}
+	g.upgrader = websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || slices.Contains(allowedOrigins, origin) || origin == "http://"+r.Host || origin == "https://"+r.Host
+		},
+	}
+	return g
+}
+
+// Serve は認証済みの userID の接続を WebSocket にアップグレードし、切断されるまで配信する
+func (g *Gateway) Serve(w http.ResponseWriter, r *http.Request, userID string) {
+	g.mu.Lock()
+	if g.closing {
+		g.mu.Unlock()
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	g.wg.Add(1)
+	g.mu.Unlock()
+	defer g.wg.Done()
+
+	ws, err := g.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade がエラーレスポンスを書いている
+		return
+	}
+
+	c := &wsConn{
+		ws:       ws,
+		userID:   userID,
+		gateway:  g,
+		send:     make(chan []byte, wsSendBufferSize),
+		topicsCh: make(chan map[string]bool),
+		quit:     make(chan struct{}),
+	}
+
+	g.mu.Lock()
+	if g.closing {
+		g.mu.Unlock()
+		ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down"), time.Now().Add(wsWriteTimeout))
+		ws.Close()
+		return
+	}
+	g.conns[c] = struct{}{}
+	g.mu.Unlock()
+
+	c.run()
+
+	g.mu.Lock()
+	delete(g.conns, c)
+	g.mu.Unlock()
+}
+
+// Shutdown は新しい接続を断り、全ての接続に送信待ちのメッセージを送り切ってから close フレームを送る
+// ctx の期限までに終わらなかった接続は強制的に閉じる
+func (g *Gateway) Shutdown(ctx context.Context) error {
+	g.mu.Lock()
+	g.closing = true
+	for c := range g.conns {
+		c.stop(websocket.CloseGoingAway, "server is shutting down")
+	}
+	g.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		for c := range g.conns {
+			c.ws.Close()
+		}
+		g.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+type wsConn struct {
+	ws      *websocket.Conn
+	userID  string
+	gateway *Gateway
+
+	send     chan []byte
+	topicsCh chan map[string]bool
+
+	quit      chan struct{}
+	closeOnce sync.Once
+	closeCode int
+	closeText string
+}
+
+// stop は接続の終了を始める。最初の呼び出しの理由だけが使われる
+// サーバー終了（CloseGoingAway）のときだけ送信待ちのメッセージを送り切る
+func (c *wsConn) stop(code int, text string) {
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		c.closeText = text
+		close(c.quit)
+	})
+}
+
+func (c *wsConn) run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		c.writeLoop()
+	}()
+	go c.eventLoop(ctx)
+
+	c.readLoop()
+
+	c.stop(websocket.CloseNormalClosure, "")
+	<-writerDone
+	c.ws.Close()
+}
+
+// readLoop はクライアントからの購読の変更を受け取る。エラー（切断を含む）で戻る
+func (c *wsConn) readLoop() {
+	c.ws.SetReadLimit(wsMaxMessageSize)
+	c.ws.SetReadDeadline(time.Now().Add(wsReadTimeout))
+	c.ws.SetPongHandler(func(string) error {
+		select {
+		case <-c.quit:
+			return nil
+		default:
+			return c.ws.SetReadDeadline(time.Now().Add(wsReadTimeout))
+		}
+	})
+
+	topics := make(map[string]bool)
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.ws.SetReadDeadline(time.Now().Add(wsReadTimeout))
+
+		var msg clientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.enqueue(serverMessage{Type: "error", Message: "invalid message"})
+			continue
+		}
+
+		switch msg.Type {
+		case "subscribe", "unsubscribe":
+			if !validTopics(msg.Topics) {
+				c.enqueue(serverMessage{Type: "error", Message: "unknown topic"})
+				continue
+			}
+			next := make(map[string]bool, len(topics))
+			for topic := range topics {
+				next[topic] = true
+			}
+			for _, topic := range msg.Topics {
+				if msg.Type == "subscribe" {
+					next[topic] = true
+				} else {
+					delete(next, topic)
+				}
+			}
+			topics = next
+
+			select {
+			case c.topicsCh <- next:
+			case <-c.quit:
+				return
+			}
+
+			current := make([]string, 0, len(topics))
+			for topic := range topics {
+				current = append(current, topic)
+			}
+			slices.Sort(current)
+			c.enqueue(serverMessage{Type: "subscribed", Topics: current})
+		case "ping":
+			c.enqueue(serverMessage{Type: "pong"})
+		default:
+			c.enqueue(serverMessage{Type: "error", Message: "unknown message type"})
+		}
+	}
+}
+
+// eventLoop は購読中のトピックのイベントを受け取り、data に変換して送信バッファに積む
+func (c *wsConn) eventLoop(ctx context.Context) {
+	userSub := c.gateway.userHub.Subscribe(c.userID)
+	defer c.gateway.userHub.Unsubscribe(userSub)
+
+	var feedSub *FeedSubscription
+	defer func() {
+		if feedSub != nil {
+			c.gateway.feedHub.Unsubscribe(feedSub)
+		}
+	}()
+
+	topics := make(map[string]bool)
+	for {
+		var feedEvents <-chan string
+		var feedDone <-chan struct{}
+		if feedSub != nil {
+			feedEvents = feedSub.Events()
+			feedDone = feedSub.Done()
+		}
+
+		select {
+		case <-c.quit:
+			return
+		case topics = <-c.topicsCh:
+			if topics[domain.TopicFeed] && feedSub == nil {
+				feedSub = c.gateway.feedHub.Subscribe(c.userID)
+			} else if !topics[domain.TopicFeed] && feedSub != nil {
+				c.gateway.feedHub.Unsubscribe(feedSub)
+				feedSub = nil
+			}
+		// ハブから打ち切られた（バッファ溢れ・Listener の再接続・サーバー終了）。取りこぼしがあり得るので再接続してもらう
+		case <-userSub.Done():
+			c.stop(websocket.CloseTryAgainLater, "events may have been missed")
+			return
+		case <-feedDone:
+			c.stop(websocket.CloseTryAgainLater, "events may have been missed")
+			return
+		case event := <-userSub.Events():
+			if topics[event.Topic] {
+				c.deliver(ctx, event)
+			}
+		case id := <-feedEvents:
+			c.deliver(ctx, Event{Topic: domain.TopicFeed, ID: id})
+		}
+	}
+}
+
+func (c *wsConn) deliver(ctx context.Context, event Event) {
+	data, err := c.gateway.resolve(ctx, c.userID, event)
+	if err != nil {
+		log.Printf("failed to resolve %s event %s: %v", event.Topic, event.ID, err)
+		return
+	}
+	if data == nil {
+		return
+	}
+	c.enqueue(serverMessage{Type: "event", Topic: event.Topic, Data: data})
+}
+
+// enqueue は送信バッファに積む。バッファが一杯なら遅いクライアントとして切断する
+func (c *wsConn) enqueue(msg serverMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Println("failed to encode websocket message:", err)
+		return
+	}
+
+	select {
+	case <-c.quit:
+	case c.send <- data:
+	default:
+		c.stop(websocket.CloseTryAgainLater, "slow consumer")
+	}
+}
+
+// writeLoop は送信バッファのメッセージと ping を書き込む。終了時は close フレームを送る
+func (c *wsConn) writeLoop() {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case data := <-c.send:
+			if err := c.write(data); err != nil {
+				c.ws.Close()
+				return
+			}
+		case <-ping.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				c.ws.Close()
+				return
+			}
+		case <-c.quit:
+			if c.closeCode == websocket.CloseGoingAway {
+				c.drain()
+			}
+			c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(c.closeCode, c.closeText), time.Now().Add(wsWriteTimeout))
+			// クライアントの close を待ってから readLoop を終わらせる
+			c.ws.SetReadDeadline(time.Now().Add(wsCloseGracePeriod))
+			return
+		}
+	}
+}
+
+// drain は送信バッファに残っているメッセージを送り切る
+func (c *wsConn) drain() {
+	for {
+		select {
+		case data := <-c.send:
+			if err := c.write(data); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (c *wsConn) write(data []byte) error {
+	c.ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return c.ws.WriteMessage(websocket.TextMessage, data)
+}
+
+func validTopics(topics []string) bool {
+	if len(topics) == 0 {
+		return false
+	}
+	for _, topic := range topics {
+		switch topic {
+		case domain.TopicFeed, domain.TopicNotifications, domain.TopicMessages:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package realtime
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// 再接続の待ち時間の上限
+const maxReconnectDelay = 30 * time.Second
+
+// Listener は Postgres の LISTEN/NOTIFY で API インスタンス間のイベントを受け取る
+// LISTEN はコネクションを占有するので、pgxpool とは別に専用のコネクションを張る
+type Listener struct {
+	dsn string
+
+	mu          sync.Mutex
+	handlers    map[string]func(ctx context.Context, payload string)
+	onReconnect []func()
+}
+
+func NewListener(dsn string) *Listener {
+	return &Listener{dsn: dsn, handlers: make(map[string]func(ctx context.Context, payload string))}
+}
+
+// Handle は channel に届いた通知を受け取るハンドラを登録する。Run の前に呼ぶ
+func (l *Listener) Handle(channel string, fn func(ctx context.Context, payload string)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.handlers[channel] = fn
+}
+
+// OnReconnect は再接続したときに呼ぶ関数を登録する
+// 切断中の通知は失われるので、購読者に取りこぼしを知らせるのに使う
+func (l *Listener) OnReconnect(fn func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onReconnect = append(l.onReconnect, fn)
+}
+
+// Run は ctx がキャンセルされるまで通知を受け取り続け、切断されたら待ち時間を延ばしながら再接続する
+func (l *Listener) Run(ctx context.Context) {
+	delay := time.Second
+	connected := false
+	for {
+		err := l.listen(ctx, func() {
+			if connected {
+				l.mu.Lock()
+				callbacks := append([]func(){}, l.onReconnect...)
+				l.mu.Unlock()
+				for _, fn := range callbacks {
+					fn()
+				}
+			}
+			connected = true
+			delay = time.Second
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("realtime listener disconnected, retrying in %s: %v", delay, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// listen は1本のコネクションで LISTEN し、エラーになるまで通知をハンドラに渡す
+func (l *Listener) listen(ctx context.Context, ready func()) error {
+	conn, err := pgx.Connect(ctx, l.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	l.mu.Lock()
+	channels := make([]string, 0, len(l.handlers))
+	for channel := range l.handlers {
+		channels = append(channels, channel)
+	}
+	l.mu.Unlock()
+
+	for _, channel := range channels {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return err
+		}
+	}
+	ready()
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		l.mu.Lock()
+		fn := l.handlers[n.Channel]
+		l.mu.Unlock()
+		if fn != nil {
+			fn(ctx, n.Payload)
+		}
+	}
+}
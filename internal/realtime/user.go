@@ -0,0 +1,114 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+)
+
+// 1購読あたりの未送信イベントのバッファ。溢れた購読は切断する
+const userBufferSize = 256
+
+// Event はリアルタイム配信するイベント。ID は Topic に応じてツイート・通知・メッセージの ID
+type Event struct {
+	Topic string
+	ID    string
+}
+
+// UserSubscription はログイン中のユーザー宛てのイベント（新しい通知・DM）の購読
+type UserSubscription struct {
+	userID string
+	events chan Event
+	done   chan struct{}
+}
+
+func (s *UserSubscription) Events() <-chan Event {
+	return s.events
+}
+
+// Done はバッファが溢れた・Listener が再接続したなどで購読が打ち切られたときに閉じる
+func (s *UserSubscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// UserHub は UserEventChannel の通知を宛先のユーザーの購読に配る
+// 宛先はペイロードに入っているので、FeedHub と違って配信のたびにクエリを発行しない
+type UserHub struct {
+	mu   sync.Mutex
+	subs map[string]map[*UserSubscription]struct{}
+}
+
+func NewUserHub() *UserHub {
+	return &UserHub{subs: make(map[string]map[*UserSubscription]struct{})}
+}
+
+// Subscribe は userID 宛てのイベントを購読する。使い終わったら Unsubscribe する
+func (h *UserHub) Subscribe(userID string) *UserSubscription {
+	sub := &UserSubscription{
+		userID: userID,
+		events: make(chan Event, userBufferSize),
+		done:   make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[*UserSubscription]struct{})
+	}
+	h.subs[userID][sub] = struct{}{}
+	return sub
+}
+
+func (h *UserHub) Unsubscribe(sub *UserSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(sub)
+}
+
+// HandleUserEvent は Listener に登録するハンドラ
+func (h *UserHub) HandleUserEvent(ctx context.Context, payload string) {
+	var event domain.UserEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		log.Println("invalid user_event payload:", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, userID := range event.UserIDs {
+		for sub := range h.subs[userID] {
+			select {
+			case sub.events <- Event{Topic: event.Topic, ID: event.ID}:
+			default:
+				h.removeLocked(sub)
+				close(sub.done)
+			}
+		}
+	}
+}
+
+// EvictAll は全ての購読を打ち切る。Listener の再接続で通知を取りこぼした可能性があるときに使う
+func (h *UserHub) EvictAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, subs := range h.subs {
+		for sub := range subs {
+			h.removeLocked(sub)
+			close(sub.done)
+		}
+	}
+}
+
+func (h *UserHub) removeLocked(sub *UserSubscription) {
+	subs := h.subs[sub.userID]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subs, sub.userID)
+	}
+}
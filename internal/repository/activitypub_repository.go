@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ActivityPubRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewActivityPubRepository(conn *pgxpool.Pool) *ActivityPubRepository {
+	return &ActivityPubRepository{conn: conn}
+}
+
+// GetActorKey は userID の鍵を取得する。まだ作っていなければ nil を返す
+func (r *ActivityPubRepository) GetActorKey(ctx context.Context, userID string) (*domain.ActorKey, error) {
+	key := domain.ActorKey{UserID: userID}
+	err := r.conn.QueryRow(ctx,
+		"SELECT public_key_pem, private_key_pem FROM actor_keys WHERE user_id = $1",
+		userID,
+	).Scan(&key.PublicKeyPEM, &key.PrivateKeyPEM)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// CreateActorKey は鍵を保存し、保存されている鍵を返す
+// 同時に作った場合は先に保存された方を使うので、返す鍵が引数の鍵と同じとは限らない
+func (r *ActivityPubRepository) CreateActorKey(ctx context.Context, key domain.ActorKey) (*domain.ActorKey, error) {
+	_, err := r.conn.Exec(ctx,
+		`INSERT INTO actor_keys (user_id, public_key_pem, private_key_pem)
+		 VALUES ($1, $2, $3)
+		 ON CONFLICT (user_id) DO NOTHING`,
+		key.UserID, key.PublicKeyPEM, key.PrivateKeyPEM,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetActorKey(ctx, key.UserID)
+}
+
+// AddRemoteFollower はリモートのフォロワーを追加する。同じ actor からのフォローは inbox と Follow の ID を更新する
+func (r *ActivityPubRepository) AddRemoteFollower(ctx context.Context, f domain.RemoteFollower) error {
+	_, err := r.conn.Exec(ctx,
+		`INSERT INTO remote_followers (user_id, actor_uri, inbox_url, shared_inbox_url, follow_activity_id)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (user_id, actor_uri) DO UPDATE SET
+			inbox_url = EXCLUDED.inbox_url,
+			shared_inbox_url = EXCLUDED.shared_inbox_url,
+			follow_activity_id = EXCLUDED.follow_activity_id`,
+		f.UserID, f.ActorURI, f.InboxURL, f.SharedInboxURL, f.FollowActivityID,
+	)
+	return err
+}
+
+// RemoveRemoteFollower はリモートのフォロワーを削除する。フォローしていなければ何もしない
+func (r *ActivityPubRepository) RemoveRemoteFollower(ctx context.Context, userID, actorURI string) error {
+	_, err := r.conn.Exec(ctx,
+		"DELETE FROM remote_followers WHERE user_id = $1 AND actor_uri = $2",
+		userID, actorURI,
+	)
+	return err
+}
+
+func (r *ActivityPubRepository) CountRemoteFollowers(ctx context.Context, userID string) (int64, error) {
+	var count int64
+	err := r.conn.QueryRow(ctx,
+		"SELECT COUNT(*) FROM remote_followers WHERE user_id = $1",
+		userID,
+	).Scan(&count)
+	return count, err
+}
+
+// GetFollowerInboxes は userID のリモートのフォロワーへの配信先を返す
+// 共有 inbox があるサーバーには、フォロワーが何人いても1回だけ配信する
+func (r *ActivityPubRepository) GetFollowerInboxes(ctx context.Context, userID string) ([]string, error) {
+	rows, err := r.conn.Query(ctx,
+		`SELECT DISTINCT COALESCE(shared_inbox_url, inbox_url)
+		 FROM remote_followers
+		 WHERE user_id = $1`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var inboxes []string
+	for rows.Next() {
+		var inbox string
+		if err := rows.Scan(&inbox); err != nil {
+			return nil, err
+		}
+		inboxes = append(inboxes, inbox)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return inboxes, nil
+}
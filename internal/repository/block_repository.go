@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const blockedEitherQuery = `
+	SELECT EXISTS(
+		SELECT 1 FROM blocks
+		WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+	)`
+
+type BlockRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewBlockRepository(conn *pgxpool.Pool) *BlockRepository {
+	return &BlockRepository{conn: conn}
+}
+
+// CreateBlock は blockerID が blockedID をブロックし、双方向のフォロー関係とフォローリクエストを削除する
+func (r *BlockRepository) CreateBlock(ctx context.Context, blockerID, blockedID string) error {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockUserPairTx(ctx, tx, blockerID, blockedID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		"INSERT INTO blocks (blocker_id, blocked_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		blockerID, blockedID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := deleteFollowTx(ctx, tx, blockerID, blockedID); err != nil {
+		return err
+	}
+	if err := deleteFollowTx(ctx, tx, blockedID, blockerID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`DELETE FROM follow_requests
+		 WHERE (requester_id = $1 AND target_id = $2) OR (requester_id = $2 AND target_id = $1)`,
+		blockerID, blockedID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *BlockRepository) DeleteBlock(ctx context.Context, blockerID, blockedID string) error {
+	_, err := r.conn.Exec(ctx,
+		"DELETE FROM blocks WHERE blocker_id = $1 AND blocked_id = $2",
+		blockerID, blockedID,
+	)
+	return err
+}
+
+// IsBlockedEither は2人のどちらかがもう一方をブロックしていれば true を返す
+func (r *BlockRepository) IsBlockedEither(ctx context.Context, userID, otherID string) (bool, error) {
+	var blocked bool
+	err := r.conn.QueryRow(ctx, blockedEitherQuery, userID, otherID).Scan(&blocked)
+	return blocked, err
+}
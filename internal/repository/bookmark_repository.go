@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type BookmarkRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewBookmarkRepository(conn *pgxpool.Pool) *BookmarkRepository {
+	return &BookmarkRepository{conn: conn}
+}
+
+// CreateBookmark は userID が tweetID をブックマークする（既にブックマーク済みなら何もしない）
+// 見えないツイート（鍵アカウントのツイート・ブロック関係にあるユーザーのツイート）は存在しないものとして ErrTweetNotFound を返す
+func (r *BookmarkRepository) CreateBookmark(ctx context.Context, userID, tweetID string) error {
+	var found bool
+	err := r.conn.QueryRow(ctx,
+		`WITH target AS (
+			SELECT t.id
+			FROM tweets t
+			INNER JOIN users u ON u.id = t.user_id
+			WHERE t.id = $2
+			  AND (
+				NOT u.protected
+				OR t.user_id = $1
+				OR EXISTS (SELECT 1 FROM follows f WHERE f.follower_id = $1 AND f.followee_id = t.user_id)
+			  )
+			  AND NOT EXISTS (
+				SELECT 1 FROM blocks b
+				WHERE (b.blocker_id = $1 AND b.blocked_id = t.user_id)
+				   OR (b.blocker_id = t.user_id AND b.blocked_id = $1)
+			  )
+		), inserted AS (
+			INSERT INTO bookmarks (user_id, tweet_id)
+			SELECT $1, id FROM target
+			ON CONFLICT DO NOTHING
+		)
+		SELECT EXISTS (SELECT 1 FROM target)`,
+		userID, tweetID,
+	).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrTweetNotFound
+	}
+	return nil
+}
+
+// DeleteBookmark はブックマークを外す（ブックマークしていなくてもエラーにしない）
+func (r *BookmarkRepository) DeleteBookmark(ctx context.Context, userID, tweetID string) error {
+	_, err := r.conn.Exec(ctx, "DELETE FROM bookmarks WHERE user_id = $1 AND tweet_id = $2", userID, tweetID)
+	return err
+}
+
+// GetBookmarks は userID のブックマークをブックマークした日時の新しい順に取得する
+// ブックマーク後に見えなくなったツイート（鍵アカウント化・ブロック）は返さない
+func (r *BookmarkRepository) GetBookmarks(ctx context.Context, userID string, cursor *domain.Cursor, limit int64) ([]domain.TweetWithUser, *domain.Cursor, error) {
+	var cursorAt *time.Time
+	var cursorID *string
+	if cursor != nil {
+		cursorAt = &cursor.CreatedAt
+		cursorID = &cursor.ID
+	}
+
+	rows, err := r.conn.Query(ctx,
+		`SELECT
+			t.id,
+			t.user_id,
+			t.content,
+			t.likes_count,
+			t.created_at,
+			t.updated_at,
+			u.id,
+			u.name,
+			u.followers_count,
+			u.followees_count,
+			u.tweets_count,
+			u.protected,
+			u.created_at,
+			u.updated_at,
+			TRUE,
+			bm.created_at
+		 FROM bookmarks bm
+		 INNER JOIN tweets t ON t.id = bm.tweet_id
+		 INNER JOIN users u ON u.id = t.user_id
+		 WHERE bm.user_id = $1
+		   AND ($2::timestamptz IS NULL OR (bm.created_at, bm.tweet_id) < ($2, $3::uuid))
+		   AND (
+			NOT u.protected
+			OR t.user_id = $1
+			OR EXISTS (SELECT 1 FROM follows f WHERE f.follower_id = $1 AND f.followee_id = t.user_id)
+		   )
+		   AND NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.blocker_id = $1 AND b.blocked_id = t.user_id)
+			   OR (b.blocker_id = t.user_id AND b.blocked_id = $1)
+		   )
+		 ORDER BY bm.created_at DESC, bm.tweet_id DESC
+		 LIMIT $4`,
+		userID, cursorAt, cursorID, limit+1,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var tweets []domain.TweetWithUser
+	var positions []time.Time
+	for rows.Next() {
+		var tweet domain.TweetWithUser
+		var at time.Time
+		if err := scanTweetWithUser(rows, &tweet, &at); err != nil {
+			return nil, nil, err
+		}
+		tweets = append(tweets, tweet)
+		positions = append(positions, at)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *domain.Cursor
+	if int64(len(tweets)) > limit {
+		tweets = tweets[:limit]
+		next = &domain.Cursor{CreatedAt: positions[limit-1], ID: tweets[limit-1].ID}
+	}
+
+	return tweets, next, nil
+}
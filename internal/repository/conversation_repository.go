@@ -0,0 +1,413 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// conversationSelect は閲覧者（$1）がメンバーになっている会話を、最新メッセージと未読数つきで取得する
+// 未読数は閲覧者の既読位置より後の、他のメンバーからのメッセージの数
+const conversationSelect = `SELECT
+		c.id,
+		c.direct_key IS NULL,
+		c.last_message_at,
+		c.created_at,
+		lm.id,
+		lm.sender_id,
+		lm.content,
+		lm.created_at,
+		(
+			SELECT COUNT(*) FROM messages m
+			WHERE m.conversation_id = c.id
+			  AND m.sender_id != me.user_id
+			  AND (lr.id IS NULL OR (m.created_at, m.id) > (lr.created_at, lr.id))
+		)
+	 FROM conversation_members me
+	 INNER JOIN conversations c ON c.id = me.conversation_id
+	 LEFT JOIN messages lr ON lr.id = me.last_read_message_id
+	 LEFT JOIN LATERAL (
+		SELECT id, sender_id, content, created_at FROM messages
+		WHERE conversation_id = c.id
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	 ) lm ON TRUE
+	 WHERE me.user_id = $1`
+
+type ConversationRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewConversationRepository(conn *pgxpool.Pool) *ConversationRepository {
+	return &ConversationRepository{conn: conn}
+}
+
+// CreateConversation は creatorID と memberIDs の会話を作成する
+// memberIDs が1人なら1対1の会話になり、既に同じ2人の会話があればそれを返す（created は false）
+func (r *ConversationRepository) CreateConversation(ctx context.Context, id, creatorID string, memberIDs []string) (*domain.Conversation, bool, error) {
+	var directKey *string
+	if len(memberIDs) == 1 {
+		pair := []string{creatorID, memberIDs[0]}
+		sort.Strings(pair)
+		key := strings.Join(pair, ":")
+		directKey = &key
+	}
+
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	conversationID := id
+	created := true
+	err = tx.QueryRow(ctx,
+		`INSERT INTO conversations (id, creator_id, direct_key) VALUES ($1, $2, $3)
+		 ON CONFLICT (direct_key) DO NOTHING
+		 RETURNING id`,
+		id, creatorID, directKey,
+	).Scan(&conversationID)
+	if err == pgx.ErrNoRows {
+		// 同じ2人の1対1の会話が既にある
+		created = false
+		err = tx.QueryRow(ctx, "SELECT id FROM conversations WHERE direct_key = $1", directKey).Scan(&conversationID)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if created {
+		_, err = tx.Exec(ctx,
+			`INSERT INTO conversation_members (conversation_id, user_id)
+			 SELECT $1, unnest($2::uuid[])`,
+			conversationID, append([]string{creatorID}, memberIDs...),
+		)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, false, err
+	}
+
+	conversation, err := r.GetConversation(ctx, conversationID, creatorID)
+	if err != nil {
+		return nil, false, err
+	}
+	return conversation, created, nil
+}
+
+// GetConversation は userID がメンバーになっている会話を取得する。メンバーでなければ ErrConversationNotFound を返す
+func (r *ConversationRepository) GetConversation(ctx context.Context, id, userID string) (*domain.Conversation, error) {
+	rows, err := r.conn.Query(ctx, conversationSelect+` AND c.id = $2`, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	conversations, err := collectConversations(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(conversations) == 0 {
+		return nil, ErrConversationNotFound
+	}
+
+	if err := r.attachMembers(ctx, conversations); err != nil {
+		return nil, err
+	}
+	return &conversations[0], nil
+}
+
+// GetConversations は userID の会話を最後のメッセージの新しい順に取得する
+func (r *ConversationRepository) GetConversations(ctx context.Context, userID string, cursor *domain.Cursor, limit int64) ([]domain.Conversation, *domain.Cursor, error) {
+	var cursorAt *time.Time
+	var cursorID *string
+	if cursor != nil {
+		cursorAt = &cursor.CreatedAt
+		cursorID = &cursor.ID
+	}
+
+	rows, err := r.conn.Query(ctx,
+		conversationSelect+`
+		   AND ($2::timestamptz IS NULL OR (c.last_message_at, c.id) < ($2, $3::uuid))
+		 ORDER BY c.last_message_at DESC, c.id DESC
+		 LIMIT $4`,
+		userID, cursorAt, cursorID, limit+1,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	conversations, err := collectConversations(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var next *domain.Cursor
+	if int64(len(conversations)) > limit {
+		conversations = conversations[:limit]
+		last := conversations[limit-1]
+		next = &domain.Cursor{CreatedAt: last.LastMessageAt, ID: last.ID}
+	}
+
+	if err := r.attachMembers(ctx, conversations); err != nil {
+		return nil, nil, err
+	}
+	return conversations, next, nil
+}
+
+func collectConversations(rows pgx.Rows) ([]domain.Conversation, error) {
+	defer rows.Close()
+
+	var conversations []domain.Conversation
+	for rows.Next() {
+		var c domain.Conversation
+		var messageID, senderID, content *string
+		var sentAt *time.Time
+		if err := rows.Scan(&c.ID, &c.Group, &c.LastMessageAt, &c.CreatedAt, &messageID, &senderID, &content, &sentAt, &c.UnreadCount); err != nil {
+			return nil, err
+		}
+		if messageID != nil {
+			c.LastMessage = &domain.Message{
+				ID:             *messageID,
+				ConversationID: c.ID,
+				SenderID:       *senderID,
+				Content:        *content,
+				CreatedAt:      *sentAt,
+			}
+		}
+		conversations = append(conversations, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
+
+// attachMembers は各会話のメンバーと既読位置を1クエリで埋める
+func (r *ConversationRepository) attachMembers(ctx context.Context, conversations []domain.Conversation) error {
+	if len(conversations) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(conversations))
+	index := make(map[string]int, len(conversations))
+	for i, c := range conversations {
+		ids[i] = c.ID
+		index[c.ID] = i
+		conversations[i].Members = []domain.ConversationMember{}
+	}
+
+	rows, err := r.conn.Query(ctx,
+		`SELECT cm.conversation_id, cm.last_read_message_id, cm.last_read_at,
+			u.id, u.name, u.followers_count, u.followees_count, u.tweets_count, u.protected, u.created_at, u.updated_at
+		 FROM conversation_members cm
+		 INNER JOIN users u ON u.id = cm.user_id
+		 WHERE cm.conversation_id = ANY($1::uuid[])
+		 ORDER BY cm.conversation_id, cm.joined_at, cm.user_id`,
+		ids,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var conversationID string
+		var m domain.ConversationMember
+		if err := rows.Scan(&conversationID, &m.LastReadMessageID, &m.LastReadAt,
+			&m.User.ID, &m.User.Name, &m.User.FollowersCount, &m.User.FolloweesCount, &m.User.TweetsCount, &m.User.Protected, &m.User.CreatedAt, &m.User.UpdatedAt); err != nil {
+			return err
+		}
+		i := index[conversationID]
+		conversations[i].Members = append(conversations[i].Members, m)
+	}
+
+	return rows.Err()
+}
+
+// SendMessage は会話にメッセージを追加し、会話の最終アクティビティと送信者の既読位置を進める
+// メンバー全員へのリアルタイム配信用に UserEventChannel へ NOTIFY する
+// senderID がメンバーでなければ ErrConversationNotFound を返す
+func (r *ConversationRepository) SendMessage(ctx context.Context, messageID, conversationID, senderID, content string) (*domain.Message, error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// 会話の行をロックし、同じ会話へのメッセージの追加を直列化する
+	// NOW() はトランザクション開始時刻なので、ロック後の時刻で送信日時の順序を追加順に揃える
+	var sentAt time.Time
+	err = tx.QueryRow(ctx,
+		`UPDATE conversations c SET last_message_at = clock_timestamp()
+		 WHERE c.id = $1
+		   AND EXISTS (SELECT 1 FROM conversation_members cm WHERE cm.conversation_id = c.id AND cm.user_id = $2)
+		 RETURNING last_message_at`,
+		conversationID, senderID,
+	).Scan(&sentAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrConversationNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	message := domain.Message{ID: messageID, ConversationID: conversationID, SenderID: senderID, Content: content, CreatedAt: sentAt}
+	_, err = tx.Exec(ctx,
+		"INSERT INTO messages (id, conversation_id, sender_id, content, created_at) VALUES ($1, $2, $3, $4, $5)",
+		message.ID, message.ConversationID, message.SenderID, message.Content, message.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE conversation_members SET last_read_message_id = $3, last_read_at = NOW()
+		 WHERE conversation_id = $1 AND user_id = $2`,
+		conversationID, senderID, messageID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, "SELECT user_id FROM conversation_members WHERE conversation_id = $1", conversationID)
+	if err != nil {
+		return nil, err
+	}
+	memberIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	if err := notifyUserEventTx(ctx, tx, domain.TopicMessages, messageID, memberIDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// GetMessage は userID がメンバーになっている会話のメッセージを1件取得する
+func (r *ConversationRepository) GetMessage(ctx context.Context, id, userID string) (*domain.Message, error) {
+	var m domain.Message
+	err := r.conn.QueryRow(ctx,
+		`SELECT m.id, m.conversation_id, m.sender_id, m.content, m.created_at
+		 FROM messages m
+		 INNER JOIN conversation_members cm ON cm.conversation_id = m.conversation_id AND cm.user_id = $2
+		 WHERE m.id = $1`,
+		id, userID,
+	).Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.Content, &m.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrMessageNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// GetMessages は会話のメッセージを新しい順に取得する。userID がメンバーでなければ ErrConversationNotFound を返す
+func (r *ConversationRepository) GetMessages(ctx context.Context, conversationID, userID string, cursor *domain.Cursor, limit int64) ([]domain.Message, *domain.Cursor, error) {
+	member, err := r.isMember(ctx, conversationID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !member {
+		return nil, nil, ErrConversationNotFound
+	}
+
+	var cursorAt *time.Time
+	var cursorID *string
+	if cursor != nil {
+		cursorAt = &cursor.CreatedAt
+		cursorID = &cursor.ID
+	}
+
+	rows, err := r.conn.Query(ctx,
+		`SELECT id, conversation_id, sender_id, content, created_at
+		 FROM messages
+		 WHERE conversation_id = $1
+		   AND ($2::timestamptz IS NULL OR (created_at, id) < ($2, $3::uuid))
+		 ORDER BY created_at DESC, id DESC
+		 LIMIT $4`,
+		conversationID, cursorAt, cursorID, limit+1,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var messages []domain.Message
+	for rows.Next() {
+		var m domain.Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.Content, &m.CreatedAt); err != nil {
+			return nil, nil, err
+		}
+		messages = append(messages, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *domain.Cursor
+	if int64(len(messages)) > limit {
+		messages = messages[:limit]
+		next = &domain.Cursor{CreatedAt: messages[limit-1].CreatedAt, ID: messages[limit-1].ID}
+	}
+
+	return messages, next, nil
+}
+
+// MarkRead は userID の既読位置を messageID（nil なら最新のメッセージ）まで進める
+// 既読位置は戻さないので、古いメッセージを指定しても何もしない
+func (r *ConversationRepository) MarkRead(ctx context.Context, conversationID, userID string, messageID *string) error {
+	member, err := r.isMember(ctx, conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return ErrConversationNotFound
+	}
+
+	var found bool
+	err = r.conn.QueryRow(ctx,
+		`WITH target AS (
+			SELECT m.id, m.created_at FROM messages m
+			WHERE m.conversation_id = $1 AND ($3::uuid IS NULL OR m.id = $3)
+			ORDER BY m.created_at DESC, m.id DESC
+			LIMIT 1
+		), updated AS (
+			UPDATE conversation_members cm SET last_read_message_id = t.id, last_read_at = NOW()
+			FROM target t
+			WHERE cm.conversation_id = $1 AND cm.user_id = $2
+			  AND NOT EXISTS (
+				SELECT 1 FROM messages lr
+				WHERE lr.id = cm.last_read_message_id AND (lr.created_at, lr.id) >= (t.created_at, t.id)
+			  )
+		)
+		SELECT EXISTS (SELECT 1 FROM target)`,
+		conversationID, userID, messageID,
+	).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if !found && messageID != nil {
+		return ErrMessageNotFound
+	}
+	return nil
+}
+
+func (r *ConversationRepository) isMember(ctx context.Context, conversationID, userID string) (bool, error) {
+	var member bool
+	err := r.conn.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM conversation_members WHERE conversation_id = $1 AND user_id = $2)",
+		conversationID, userID,
+	).Scan(&member)
+	return member, err
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type DraftRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewDraftRepository(conn *pgxpool.Pool) *DraftRepository {
+	return &DraftRepository{conn: conn}
+}
+
+func (r *DraftRepository) CreateDraft(ctx context.Context, id, userID, content string) (*domain.Draft, error) {
+	var draft domain.Draft
+	err := r.conn.QueryRow(ctx,
+		`INSERT INTO drafts (id, user_id, content)
+		 VALUES ($1, $2, $3)
+		 RETURNING id, user_id, content, created_at, updated_at`,
+		id, userID, content,
+	).Scan(&draft.ID, &draft.UserID, &draft.Content, &draft.CreatedAt, &draft.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &draft, nil
+}
+
+func (r *DraftRepository) GetDraft(ctx context.Context, id, userID string) (*domain.Draft, error) {
+	var draft domain.Draft
+	err := r.conn.QueryRow(ctx,
+		"SELECT id, user_id, content, created_at, updated_at FROM drafts WHERE id = $1 AND user_id = $2",
+		id, userID,
+	).Scan(&draft.ID, &draft.UserID, &draft.Content, &draft.CreatedAt, &draft.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrDraftNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &draft, nil
+}
+
+// GetDrafts は userID の下書きを更新日時の新しい順に取得する
+func (r *DraftRepository) GetDrafts(ctx context.Context, userID string) ([]domain.Draft, error) {
+	rows, err := r.conn.Query(ctx,
+		`SELECT id, user_id, content, created_at, updated_at
+		 FROM drafts
+		 WHERE user_id = $1
+		 ORDER BY updated_at DESC, id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drafts []domain.Draft
+	for rows.Next() {
+		var draft domain.Draft
+		if err := rows.Scan(&draft.ID, &draft.UserID, &draft.Content, &draft.CreatedAt, &draft.UpdatedAt); err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, draft)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return drafts, nil
+}
+
+func (r *DraftRepository) UpdateDraft(ctx context.Context, id, userID, content string) (*domain.Draft, error) {
+	var draft domain.Draft
+	err := r.conn.QueryRow(ctx,
+		`UPDATE drafts SET content = $3, updated_at = NOW()
+		 WHERE id = $1 AND user_id = $2
+		 RETURNING id, user_id, content, created_at, updated_at`,
+		id, userID, content,
+	).Scan(&draft.ID, &draft.UserID, &draft.Content, &draft.CreatedAt, &draft.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrDraftNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &draft, nil
+}
+
+func (r *DraftRepository) DeleteDraft(ctx context.Context, id, userID string) error {
+	tag, err := r.conn.Exec(ctx, "DELETE FROM drafts WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDraftNotFound
+	}
+	return nil
+}
+
+// PublishDraft は下書きを削除し、同じトランザクションで tweetID のツイートとして投稿する
+// content は呼び出し側が検証した本文で、その後に下書きが書き換えられていた場合は投稿せず ErrDraftNotFound を返す
+func (r *DraftRepository) PublishDraft(ctx context.Context, id, userID, tweetID, content string) (*domain.Tweet, error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, "DELETE FROM drafts WHERE id = $1 AND user_id = $2 AND content = $3", id, userID, content)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrDraftNotFound
+	}
+
+	tweet, err := insertTweetTx(ctx, tx, tweetID, userID, content)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return tweet, nil
+}
@@ -3,8 +3,29 @@ package repository
 import "errors"
 
 var (
-	ErrUserNotFound   = errors.New("user not found")
-	ErrDuplicateUser  = errors.New("user name is already used")
-	ErrDuplicateTweet = errors.New("duplicate tweet")
-	ErrNotImplemented = errors.New("not implemented")
+	ErrUserNotFound            = errors.New("user not found")
+	ErrDuplicateUser           = errors.New("user name is already used")
+	ErrDuplicateTweet          = errors.New("duplicate tweet")
+	ErrNotImplemented          = errors.New("not implemented")
+	ErrBlocked                 = errors.New("blocked")
+	ErrMutedWordNotFound       = errors.New("muted word not found")
+	ErrFollowRequestNotFound   = errors.New("follow request not found")
+	ErrListNotFound            = errors.New("list not found")
+	ErrTweetNotFound           = errors.New("tweet not found")
+	ErrScheduledTweetNotFound  = errors.New("scheduled tweet not found")
+	ErrDraftNotFound           = errors.New("draft not found")
+	ErrPollNotFound            = errors.New("poll not found")
+	ErrPollOptionNotFound      = errors.New("poll option not found")
+	ErrPollClosed              = errors.New("poll is closed")
+	ErrAlreadyVoted            = errors.New("already voted")
+	ErrMediaNotFound           = errors.New("media not found")
+	ErrConversationNotFound    = errors.New("conversation not found")
+	ErrMessageNotFound         = errors.New("message not found")
+	ErrDMNotAllowed            = errors.New("user does not accept direct messages from you")
+	ErrNotificationNotFound    = errors.New("notification not found")
+	ErrWebhookNotFound         = errors.New("webhook not found")
+	ErrWebhookLimitExceeded    = errors.New("too many webhooks")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrJobNotFound             = errors.New("job not found")
+	ErrJobNotDead              = errors.New("job is not dead")
 )
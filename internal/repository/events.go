@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+// API インスタンス間でリアルタイム配信のきっかけを伝える NOTIFY のチャンネル
+// NOTIFY はコミットされたときにだけ配信されるので、ロールバックした変更は届かない
+const (
+	// TweetCreatedChannel のペイロードは domain.TweetCreatedEvent
+	TweetCreatedChannel = "tweet_created"
+	// UserEventChannel のペイロードは domain.UserEvent（宛先のユーザーが決まっているイベント）
+	UserEventChannel = "user_event"
+	// OutboxChannel は outbox に書き込んだことを relay に知らせる。ペイロードは空
+	OutboxChannel = "outbox"
+	// JobsChannel はジョブを積んだことをワーカーに知らせる。ペイロードはキューの名前
+	JobsChannel = "jobs"
+)
+
+// notifyTweetCreatedTx は TweetCreatedChannel に新しいツイートを NOTIFY する
+func notifyTweetCreatedTx(ctx context.Context, tx pgx.Tx, tweetID, userID string) error {
+	return pgNotifyTx(ctx, tx, TweetCreatedChannel, domain.TweetCreatedEvent{ID: tweetID, UserID: userID})
+}
+
+// notifyUserEventTx は UserEventChannel に userIDs 宛てのイベントを NOTIFY する
+func notifyUserEventTx(ctx context.Context, tx pgx.Tx, topic, id string, userIDs []string) error {
+	return pgNotifyTx(ctx, tx, UserEventChannel, domain.UserEvent{Topic: topic, ID: id, UserIDs: userIDs})
+}
+
+func pgNotifyTx(ctx context.Context, tx pgx.Tx, channel string, event any) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "SELECT pg_notify($1, $2)", channel, string(payload))
+	return err
+}
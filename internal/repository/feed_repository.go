@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -17,6 +18,9 @@ func NewFeedRepository(conn *pgxpool.Pool) *FeedRepository {
 
 // GetFeedTweets はログインユーザーがフォローしているユーザーのツイートを取得する
 // Pull型ニュースフィード実装（OFFSET/LIMITベースページネーション）
+// ブロック関係にあるユーザー・ミュート中のユーザーのツイートと、ミュートワードを含むツイートは含めない
+// 除外は LIMIT/OFFSET より前に SQL で行うので、ページの件数が足りなくなることはない
+// bookmarked は同じクエリの EXISTS で求め、ツイートごとにクエリを発行しない
 func (r *FeedRepository) GetFeedTweets(ctx context.Context, userID string, offset int64, limit int64) ([]domain.TweetWithUser, error) {
 	query := `
 		SELECT
@@ -28,12 +32,31 @@ func (r *FeedRepository) GetFeedTweets(ctx context.Context, userID string, offse
 			t.updated_at,
 			u.id,
 			u.name,
+			u.followers_count,
+			u.followees_count,
+			u.tweets_count,
+			u.protected,
 			u.created_at,
-			u.updated_at
+			u.updated_at,
+			EXISTS (SELECT 1 FROM bookmarks bm WHERE bm.user_id = $1 AND bm.tweet_id = t.id)
 		FROM tweets t
 		INNER JOIN follows f ON t.user_id = f.followee_id
 		INNER JOIN users u ON t.user_id = u.id
 		WHERE f.follower_id = $1
+		  AND NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.blocker_id = $1 AND b.blocked_id = t.user_id)
+			   OR (b.blocker_id = t.user_id AND b.blocked_id = $1)
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM mutes m WHERE m.muter_id = $1 AND m.muted_id = t.user_id
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM muted_words mw
+			WHERE mw.user_id = $1
+			  AND (mw.expires_at IS NULL OR mw.expires_at > NOW())
+			  AND t.content ~* mw.pattern
+		  )
 		ORDER BY t.created_at DESC, t.id DESC
 		LIMIT $2 OFFSET $3
 	`
@@ -44,22 +67,147 @@ func (r *FeedRepository) GetFeedTweets(ctx context.Context, userID string, offse
 	}
 	defer rows.Close()
 
+	return collectTweetsWithUser(rows)
+}
+
+// feedStreamSelect は GetFeedTweets と同じ条件でフィードのツイートを選ぶ。呼び出し側で $2 以降の条件と並び順を足す
+const feedStreamSelect = `
+		SELECT
+			t.id,
+			t.user_id,
+			t.content,
+			t.likes_count,
+			t.created_at,
+			t.updated_at,
+			u.id,
+			u.name,
+			u.followers_count,
+			u.followees_count,
+			u.tweets_count,
+			u.protected,
+			u.created_at,
+			u.updated_at,
+			EXISTS (SELECT 1 FROM bookmarks bm WHERE bm.user_id = $1 AND bm.tweet_id = t.id)
+		FROM tweets t
+		INNER JOIN follows f ON t.user_id = f.followee_id
+		INNER JOIN users u ON t.user_id = u.id
+		WHERE f.follower_id = $1
+		  AND NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.blocker_id = $1 AND b.blocked_id = t.user_id)
+			   OR (b.blocker_id = t.user_id AND b.blocked_id = $1)
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM mutes m WHERE m.muter_id = $1 AND m.muted_id = t.user_id
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM muted_words mw
+			WHERE mw.user_id = $1
+			  AND (mw.expires_at IS NULL OR mw.expires_at > NOW())
+			  AND t.content ~* mw.pattern
+		  )`
+
+// GetFeedTweetsByIDs は ids のうち userID のフィードに出るツイートだけを古い順に取得する（ストリーミング配信用）
+// 削除済み・フォロー解除済み・ブロックやミュートの対象になったツイートは返さない
+func (r *FeedRepository) GetFeedTweetsByIDs(ctx context.Context, userID string, ids []string) ([]domain.TweetWithUser, error) {
+	rows, err := r.conn.Query(ctx,
+		feedStreamSelect+`
+		  AND t.id = ANY($2::uuid[])
+		ORDER BY t.created_at, t.id`,
+		userID, ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return collectTweetsWithUser(rows)
+}
+
+// GetFeedTweetsSince は since より新しいフィードのツイートを古い順に最大 limit 件取得する（Last-Event-ID からの再開用）
+func (r *FeedRepository) GetFeedTweetsSince(ctx context.Context, userID string, since domain.Cursor, limit int64) ([]domain.TweetWithUser, error) {
+	rows, err := r.conn.Query(ctx,
+		feedStreamSelect+`
+		  AND (t.created_at, t.id) > ($2, $3::uuid)
+		ORDER BY t.created_at, t.id
+		LIMIT $4`,
+		userID, since.CreatedAt, since.ID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return collectTweetsWithUser(rows)
+}
+
+// GetListTweets はリストのメンバーのツイートを取得する（GetFeedTweets のフォローの代わりにリストメンバーを使う版）
+// 鍵アカウントのツイートは本人とフォロワーにしか返さない
+// viewerID が空でなければ、フィードと同じくブロック関係にあるユーザー・ミュート中のユーザーのツイートとミュートワードを含むツイートも除外する
+func (r *FeedRepository) GetListTweets(ctx context.Context, viewerID, listID string, offset int64, limit int64) ([]domain.TweetWithUser, error) {
+	var viewer *string
+	if viewerID != "" {
+		viewer = &viewerID
+	}
+
+	query := `
+		SELECT
+			t.id,
+			t.user_id,
+			t.content,
+			t.likes_count,
+			t.created_at,
+			t.updated_at,
+			u.id,
+			u.name,
+			u.followers_count,
+			u.followees_count,
+			u.tweets_count,
+			u.protected,
+			u.created_at,
+			u.updated_at,
+			EXISTS (SELECT 1 FROM bookmarks bm WHERE bm.user_id = $2 AND bm.tweet_id = t.id)
+		FROM tweets t
+		INNER JOIN list_members lm ON t.user_id = lm.user_id
+		INNER JOIN users u ON t.user_id = u.id
+		WHERE lm.list_id = $1
+		  AND (
+			NOT u.protected
+			OR t.user_id = $2
+			OR EXISTS (SELECT 1 FROM follows f WHERE f.follower_id = $2 AND f.followee_id = t.user_id)
+		  )
+		  AND ($2::uuid IS NULL OR NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.blocker_id = $2 AND b.blocked_id = t.user_id)
+			   OR (b.blocker_id = t.user_id AND b.blocked_id = $2)
+		  ))
+		  AND NOT EXISTS (
+			SELECT 1 FROM mutes m WHERE m.muter_id = $2 AND m.muted_id = t.user_id
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM muted_words mw
+			WHERE mw.user_id = $2
+			  AND (mw.expires_at IS NULL OR mw.expires_at > NOW())
+			  AND t.content ~* mw.pattern
+		  )
+		ORDER BY t.created_at DESC, t.id DESC
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := r.conn.Query(ctx, query, listID, viewer, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return collectTweetsWithUser(rows)
+}
+
+// collectTweetsWithUser は (ツイート列..., ユーザー列..., ブックマーク済みか) の行を TweetWithUser に読み込む
+func collectTweetsWithUser(rows pgx.Rows) ([]domain.TweetWithUser, error) {
 	var tweets []domain.TweetWithUser
 	for rows.Next() {
 		var tweet domain.TweetWithUser
-		err := rows.Scan(
-			&tweet.ID,
-			&tweet.UserID,
-			&tweet.Content,
-			&tweet.LikesCount,
-			&tweet.CreatedAt,
-			&tweet.UpdatedAt,
-			&tweet.User.ID,
-			&tweet.User.Name,
-			&tweet.User.CreatedAt,
-			&tweet.User.UpdatedAt,
-		)
-		if err != nil {
+		if err := scanTweetWithUser(rows, &tweet); err != nil {
 			return nil, err
 		}
 		tweets = append(tweets, tweet)
@@ -71,3 +219,25 @@ func (r *FeedRepository) GetFeedTweets(ctx context.Context, userID string, offse
 
 	return tweets, nil
 }
+
+// scanTweetWithUser は1行分を tweet に読み込む。extra はブックマーク列の後ろに続く列の読み込み先
+func scanTweetWithUser(row pgx.Row, tweet *domain.TweetWithUser, extra ...any) error {
+	dest := []any{
+		&tweet.ID,
+		&tweet.UserID,
+		&tweet.Content,
+		&tweet.LikesCount,
+		&tweet.CreatedAt,
+		&tweet.UpdatedAt,
+		&tweet.User.ID,
+		&tweet.User.Name,
+		&tweet.User.FollowersCount,
+		&tweet.User.FolloweesCount,
+		&tweet.User.TweetsCount,
+		&tweet.User.Protected,
+		&tweet.User.CreatedAt,
+		&tweet.User.UpdatedAt,
+		&tweet.Bookmarked,
+	}
+	return row.Scan(append(dest, extra...)...)
+}
@@ -2,8 +2,10 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -15,78 +17,418 @@ func NewFollowRepository(conn *pgxpool.Pool) *FollowRepository {
 	return &FollowRepository{conn: conn}
 }
 
-func (r *FollowRepository) CreateFollow(ctx context.Context, followerID, followeeID string) error {
-	_, err := r.conn.Exec(ctx,
-		"INSERT INTO follows (follower_id, followee_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+// CreateFollow は followerID から followeeID へのフォロー関係を作成する
+// followeeID が鍵アカウントならフォロー関係ではなく承認待ちのフォローリクエストを作り、true を返す（既にフォローしている場合は何もせず false）
+// followeeID が存在しなければ ErrUserNotFound、どちらかがもう一方をブロックしている場合は ErrBlocked を返す
+func (r *FollowRepository) CreateFollow(ctx context.Context, followerID, followeeID string) (bool, error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// 同時に走るブロックと直列化し、ブロック後にフォローが残らないようにする
+	if err := lockUserPairTx(ctx, tx, followerID, followeeID); err != nil {
+		return false, err
+	}
+
+	blocked, err := isBlockedEitherTx(ctx, tx, followerID, followeeID)
+	if err != nil {
+		return false, err
+	}
+	if blocked {
+		return false, ErrBlocked
+	}
+
+	protected, err := lockFollowUsersTx(ctx, tx, followerID, followeeID)
+	if err != nil {
+		return false, err
+	}
+
+	if !protected {
+		if err := insertFollowTx(ctx, tx, followerID, followeeID); err != nil {
+			return false, err
+		}
+		return false, tx.Commit(ctx)
+	}
+
+	var following bool
+	err = tx.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM follows WHERE follower_id = $1 AND followee_id = $2)",
+		followerID, followeeID,
+	).Scan(&following)
+	if err != nil {
+		return false, err
+	}
+	if following {
+		return false, nil
+	}
+
+	_, err = tx.Exec(ctx,
+		"INSERT INTO follow_requests (requester_id, target_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
 		followerID, followeeID,
 	)
-	return err
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
 
+// DeleteFollow はフォロー関係を削除する。承認待ちのフォローリクエストがあればそれも取り消す
 func (r *FollowRepository) DeleteFollow(ctx context.Context, followerID, followeeID string) error {
-	_, err := r.conn.Exec(ctx,
-		"DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2",
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := deleteFollowTx(ctx, tx, followerID, followeeID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		"DELETE FROM follow_requests WHERE requester_id = $1 AND target_id = $2",
 		followerID, followeeID,
 	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ApproveFollowRequest は requesterID から targetID へのフォローリクエストを承認し、フォロー関係を作成する
+func (r *FollowRepository) ApproveFollowRequest(ctx context.Context, targetID, requesterID string) error {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockUserPairTx(ctx, tx, requesterID, targetID); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx,
+		"DELETE FROM follow_requests WHERE requester_id = $1 AND target_id = $2",
+		requesterID, targetID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrFollowRequestNotFound
+	}
+
+	if err := insertFollowTx(ctx, tx, requesterID, targetID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RejectFollowRequest は requesterID から targetID へのフォローリクエストを削除する
+func (r *FollowRepository) RejectFollowRequest(ctx context.Context, targetID, requesterID string) error {
+	tag, err := r.conn.Exec(ctx,
+		"DELETE FROM follow_requests WHERE requester_id = $1 AND target_id = $2",
+		requesterID, targetID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrFollowRequestNotFound
+	}
+
+	return nil
+}
+
+// GetFollowRequests は targetID に届いている承認待ちのフォローリクエストの送信者を新しい順に取得する
+func (r *FollowRepository) GetFollowRequests(ctx context.Context, targetID string, cursor *domain.Cursor, limit int64) ([]domain.User, *domain.Cursor, error) {
+	return r.queryFollowUsers(ctx,
+		`SELECT u.id, u.name, u.followers_count, u.followees_count, u.tweets_count, u.protected, u.created_at, u.updated_at, fr.created_at
+		 FROM follow_requests fr
+		 INNER JOIN users u ON u.id = fr.requester_id
+		 WHERE fr.target_id = $1
+		   AND ($2::timestamptz IS NULL OR (fr.created_at, fr.requester_id) < ($2, $3::uuid))
+		 ORDER BY fr.created_at DESC, fr.requester_id DESC
+		 LIMIT $4`,
+		targetID, cursor, limit,
+	)
+}
+
+// lockUserPairTx は2人のユーザーの組に対するトランザクションスコープの advisory lock を取る
+// フォローとブロックのように、同じ2人の関係を変更する処理どうしを直列化するために使う
+func lockUserPairTx(ctx context.Context, tx pgx.Tx, userID, otherID string) error {
+	_, err := tx.Exec(ctx,
+		"SELECT pg_advisory_xact_lock(hashtextextended(LEAST($1::text, $2::text) || ':' || GREATEST($1::text, $2::text), 0))",
+		userID, otherID,
+	)
 	return err
 }
 
-func (r *FollowRepository) GetFollowers(ctx context.Context, userID string) ([]domain.User, error) {
+// lockFollowUsersTx は2人の users の行をロックし、followeeID が鍵アカウントかを返す
+// 鍵アカウントの切り替え（UserRepository.UpdateUser）と直列化し、公開中に読んだ protected のまま鍵アカウントをフォローしないようにする
+// 行は adjustFollowCountsTx と同じ ID 順にロックするので、カウンタの更新とデッドロックしない
+func lockFollowUsersTx(ctx context.Context, tx pgx.Tx, followerID, followeeID string) (bool, error) {
+	rows, err := tx.Query(ctx,
+		"SELECT id, protected FROM users WHERE id = ANY($1::uuid[]) ORDER BY id FOR NO KEY UPDATE",
+		[]string{followerID, followeeID},
+	)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	found := false
+	protected := false
+	for rows.Next() {
+		var id string
+		var p bool
+		if err := rows.Scan(&id, &p); err != nil {
+			return false, err
+		}
+		if id == followeeID {
+			found, protected = true, p
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	if !found {
+		return false, ErrUserNotFound
+	}
+	return protected, nil
+}
+
+func isBlockedEitherTx(ctx context.Context, tx pgx.Tx, userID, otherID string) (bool, error) {
+	var blocked bool
+	err := tx.QueryRow(ctx, blockedEitherQuery, userID, otherID).Scan(&blocked)
+	return blocked, err
+}
+
+// insertFollowTx はフォロー関係を作成し、新規に作成できた場合のみカウンタを加算し、outbox にイベントを書き込んでフォローされた側に通知する
+func insertFollowTx(ctx context.Context, tx pgx.Tx, followerID, followeeID string) error {
+	tag, err := tx.Exec(ctx,
+		"INSERT INTO follows (follower_id, followee_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		followerID, followeeID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	if err := adjustFollowCountsTx(ctx, tx, followerID, followeeID, 1); err != nil {
+		return err
+	}
+
+	if err := appendOutboxTx(ctx, tx, domain.EventFollowCreated, followerID, domain.FollowEventPayload{FollowerID: followerID, FolloweeID: followeeID}); err != nil {
+		return err
+	}
+
+	return notifyTx(ctx, tx, followeeID, followerID, domain.NotificationFollow, nil)
+}
+
+// deleteFollowTx はフォロー関係を削除し、実際に削除できた場合のみカウンタを減算して outbox にイベントを書き込む
+func deleteFollowTx(ctx context.Context, tx pgx.Tx, followerID, followeeID string) error {
+	tag, err := tx.Exec(ctx,
+		"DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2",
+		followerID, followeeID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	if err := adjustFollowCountsTx(ctx, tx, followerID, followeeID, -1); err != nil {
+		return err
+	}
+
+	return appendOutboxTx(ctx, tx, domain.EventFollowDeleted, followerID, domain.FollowEventPayload{FollowerID: followerID, FolloweeID: followeeID})
+}
+
+// adjustFollowCountsTx は follower の followees_count と followee の followers_count を delta だけ増減する
+// 相互フォローが同時に走ったときのデッドロックを避けるため、常に ID の昇順で行ロックを取る
+func adjustFollowCountsTx(ctx context.Context, tx pgx.Tx, followerID, followeeID string, delta int) error {
+	updates := []struct {
+		query  string
+		userID string
+	}{
+		{"UPDATE users SET followees_count = followees_count + $2 WHERE id = $1", followerID},
+		{"UPDATE users SET followers_count = followers_count + $2 WHERE id = $1", followeeID},
+	}
+	if followeeID < followerID {
+		updates[0], updates[1] = updates[1], updates[0]
+	}
+
+	for _, u := range updates {
+		if _, err := tx.Exec(ctx, u.query, u.userID, delta); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetRelationships は viewerID から見た userIDs の各ユーザーとの関係をまとめて取得する
+// 存在しないユーザーは結果に含まれない
+func (r *FollowRepository) GetRelationships(ctx context.Context, viewerID string, userIDs []string) (map[string]domain.Relationship, error) {
 	rows, err := r.conn.Query(ctx,
-		`SELECT u.id, u.name, u.created_at, u.updated_at
+		`SELECT
+			u.id,
+			EXISTS(SELECT 1 FROM follows f WHERE f.follower_id = $1 AND f.followee_id = u.id),
+			EXISTS(SELECT 1 FROM follows f WHERE f.follower_id = u.id AND f.followee_id = $1),
+			EXISTS(SELECT 1 FROM blocks b WHERE b.blocker_id = $1 AND b.blocked_id = u.id),
+			EXISTS(SELECT 1 FROM blocks b WHERE b.blocker_id = u.id AND b.blocked_id = $1),
+			EXISTS(SELECT 1 FROM mutes m WHERE m.muter_id = $1 AND m.muted_id = u.id),
+			EXISTS(SELECT 1 FROM follow_requests fr WHERE fr.requester_id = $1 AND fr.target_id = u.id)
 		 FROM users u
-		 INNER JOIN follows f ON u.id = f.follower_id
-		 WHERE f.followee_id = $1
-		 ORDER BY f.created_at DESC`,
-		userID,
+		 WHERE u.id = ANY($2::uuid[])`,
+		viewerID, userIDs,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var users []domain.User
+	relationships := make(map[string]domain.Relationship, len(userIDs))
 	for rows.Next() {
-		var user domain.User
-		if err := rows.Scan(&user.ID, &user.Name, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		var rel domain.Relationship
+		if err := rows.Scan(&rel.UserID, &rel.Following, &rel.FollowedBy, &rel.Blocking, &rel.BlockedBy, &rel.Muting, &rel.FollowRequested); err != nil {
 			return nil, err
 		}
-		users = append(users, user)
+		relationships[rel.UserID] = rel
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return users, nil
+	return relationships, nil
 }
 
-func (r *FollowRepository) GetFollowees(ctx context.Context, userID string) ([]domain.User, error) {
+// FilterFollowers は userIDs のうち followeeID をフォローしているユーザーだけを返す
+func (r *FollowRepository) FilterFollowers(ctx context.Context, followeeID string, userIDs []string) ([]string, error) {
 	rows, err := r.conn.Query(ctx,
-		`SELECT u.id, u.name, u.created_at, u.updated_at
-		 FROM users u
-		 INNER JOIN follows f ON u.id = f.followee_id
-		 WHERE f.follower_id = $1
-		 ORDER BY f.created_at DESC`,
-		userID,
+		"SELECT follower_id FROM follows WHERE followee_id = $1 AND follower_id = ANY($2::uuid[])",
+		followeeID, userIDs,
 	)
 	if err != nil {
 		return nil, err
 	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// GetFollowers は userID をフォローしているユーザーをフォロー日時の新しい順に取得する
+// cursor が nil の場合は先頭から。次のページがある場合は次のカーソルを返す
+func (r *FollowRepository) GetFollowers(ctx context.Context, userID string, cursor *domain.Cursor, limit int64) ([]domain.User, *domain.Cursor, error) {
+	return r.queryFollowUsers(ctx,
+		`SELECT u.id, u.name, u.followers_count, u.followees_count, u.tweets_count, u.protected, u.created_at, u.updated_at, f.created_at
+		 FROM follows f
+		 INNER JOIN users u ON u.id = f.follower_id
+		 WHERE f.followee_id = $1
+		   AND ($2::timestamptz IS NULL OR (f.created_at, f.follower_id) < ($2, $3::uuid))
+		 ORDER BY f.created_at DESC, f.follower_id DESC
+		 LIMIT $4`,
+		userID, cursor, limit,
+	)
+}
+
+// GetFollowees は userID がフォローしているユーザーをフォロー日時の新しい順に取得する
+func (r *FollowRepository) GetFollowees(ctx context.Context, userID string, cursor *domain.Cursor, limit int64) ([]domain.User, *domain.Cursor, error) {
+	return r.queryFollowUsers(ctx,
+		`SELECT u.id, u.name, u.followers_count, u.followees_count, u.tweets_count, u.protected, u.created_at, u.updated_at, f.created_at
+		 FROM follows f
+		 INNER JOIN users u ON u.id = f.followee_id
+		 WHERE f.follower_id = $1
+		   AND ($2::timestamptz IS NULL OR (f.created_at, f.followee_id) < ($2, $3::uuid))
+		 ORDER BY f.created_at DESC, f.followee_id DESC
+		 LIMIT $4`,
+		userID, cursor, limit,
+	)
+}
+
+// GetMutuals は userID と相互フォローしているユーザーを userID がフォローした日時の新しい順に取得する
+// f1 は idx_follows_follower で userID のフォロー先を辿り、逆向きの辺 f2 は主キーで1件ずつ引く
+func (r *FollowRepository) GetMutuals(ctx context.Context, userID string, cursor *domain.Cursor, limit int64) ([]domain.User, *domain.Cursor, error) {
+	return r.queryFollowUsers(ctx,
+		`SELECT u.id, u.name, u.followers_count, u.followees_count, u.tweets_count, u.protected, u.created_at, u.updated_at, f1.created_at
+		 FROM follows f1
+		 INNER JOIN follows f2 ON f2.follower_id = f1.followee_id AND f2.followee_id = f1.follower_id
+		 INNER JOIN users u ON u.id = f1.followee_id
+		 WHERE f1.follower_id = $1
+		   AND ($2::timestamptz IS NULL OR (f1.created_at, f1.followee_id) < ($2, $3::uuid))
+		 ORDER BY f1.created_at DESC, f1.followee_id DESC
+		 LIMIT $4`,
+		userID, cursor, limit,
+	)
+}
+
+// GetFollowersYouKnow は userID のフォロワーのうち viewerID がフォローしているユーザーを
+// userID をフォローした日時の新しい順に取得する
+// f1 は idx_follows_followee で userID のフォロワーを辿り、viewerID からの辺 f2 は主キーで1件ずつ引く
+func (r *FollowRepository) GetFollowersYouKnow(ctx context.Context, viewerID, userID string, cursor *domain.Cursor, limit int64) ([]domain.User, *domain.Cursor, error) {
+	return r.queryFollowUsers(ctx,
+		`SELECT u.id, u.name, u.followers_count, u.followees_count, u.tweets_count, u.protected, u.created_at, u.updated_at, f1.created_at
+		 FROM follows f1
+		 INNER JOIN follows f2 ON f2.follower_id = $5 AND f2.followee_id = f1.follower_id
+		 INNER JOIN users u ON u.id = f1.follower_id
+		 WHERE f1.followee_id = $1
+		   AND ($2::timestamptz IS NULL OR (f1.created_at, f1.follower_id) < ($2, $3::uuid))
+		 ORDER BY f1.created_at DESC, f1.follower_id DESC
+		 LIMIT $4`,
+		userID, cursor, limit, viewerID,
+	)
+}
+
+// queryFollowUsers は (ユーザー列..., 並び順の日時) を返すクエリを limit + 1 件で実行し、
+// 次のページがあれば最後の行の位置をカーソルとして返す
+// クエリのパラメータは $1: userID, $2: カーソル日時, $3: カーソルID, $4: 取得件数, $5 以降: extra
+func (r *FollowRepository) queryFollowUsers(ctx context.Context, query, userID string, cursor *domain.Cursor, limit int64, extra ...any) ([]domain.User, *domain.Cursor, error) {
+	var cursorAt *time.Time
+	var cursorID *string
+	if cursor != nil {
+		cursorAt = &cursor.CreatedAt
+		cursorID = &cursor.ID
+	}
+
+	args := append([]any{userID, cursorAt, cursorID, limit + 1}, extra...)
+	rows, err := r.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
 	defer rows.Close()
 
 	var users []domain.User
+	var positions []time.Time
 	for rows.Next() {
 		var user domain.User
-		if err := rows.Scan(&user.ID, &user.Name, &user.CreatedAt, &user.UpdatedAt); err != nil {
-			return nil, err
+		var at time.Time
+		if err := rows.Scan(&user.ID, &user.Name, &user.FollowersCount, &user.FolloweesCount, &user.TweetsCount, &user.Protected, &user.CreatedAt, &user.UpdatedAt, &at); err != nil {
+			return nil, nil, err
 		}
 		users = append(users, user)
+		positions = append(positions, at)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	var next *domain.Cursor
+	if int64(len(users)) > limit {
+		users = users[:limit]
+		next = &domain.Cursor{CreatedAt: positions[limit-1], ID: users[limit-1].ID}
 	}
 
-	return users, nil
+	return users, next, nil
 }
@@ -0,0 +1,260 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const jobColumns = `id, queue, kind, payload, status, attempts, max_attempts, run_at, locked_until, last_error, finished_at, created_at, updated_at`
+
+type JobRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewJobRepository(conn *pgxpool.Pool) *JobRepository {
+	return &JobRepository{conn: conn}
+}
+
+// Enqueue はジョブを積み、JobsChannel に NOTIFY して待っているワーカーを起こす
+func (r *JobRepository) Enqueue(ctx context.Context, id, queue, kind string, payload []byte, runAt time.Time, maxAttempts int) (*domain.Job, error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	job, err := scanJob(tx.QueryRow(ctx,
+		`INSERT INTO jobs (id, queue, kind, payload, run_at, max_attempts)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING `+jobColumns,
+		id, queue, kind, payload, runAt, maxAttempts,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, "SELECT pg_notify($1, $2)", JobsChannel, queue); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// Claim は queue のうち kinds のジョブを1件取り出して running にし、試行回数を増やす
+// 実行時刻を過ぎた queued のジョブに加えて、可視性タイムアウトを過ぎた running のジョブ（ワーカーが落ちたもの）も取り直す
+// 取り出せるジョブがなければ nil を返す
+func (r *JobRepository) Claim(ctx context.Context, queue string, kinds []string, timeout time.Duration) (*domain.Job, error) {
+	job, err := scanJob(r.conn.QueryRow(ctx,
+		`UPDATE jobs SET
+			status = 'running',
+			attempts = attempts + 1,
+			locked_until = NOW() + $3 * INTERVAL '1 second',
+			updated_at = NOW()
+		 WHERE id = (
+			SELECT id FROM jobs
+			WHERE queue = $1 AND kind = ANY($2::text[])
+			  AND (
+				(status = 'queued' AND run_at <= NOW())
+				OR (status = 'running' AND locked_until < NOW())
+			  )
+			ORDER BY run_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING `+jobColumns,
+		queue, kinds, timeout.Seconds(),
+	))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Complete は attempt 回目の試行の成功を記録する
+// 可視性タイムアウトを過ぎて他のワーカーが取り直していた場合（attempts が変わっている）は何もしない
+func (r *JobRepository) Complete(ctx context.Context, id string, attempt int) error {
+	_, err := r.conn.Exec(ctx,
+		`UPDATE jobs SET
+			status = 'succeeded', locked_until = NULL, last_error = NULL, finished_at = NOW(), updated_at = NOW()
+		 WHERE id = $1 AND attempts = $2 AND status = 'running'`,
+		id, attempt,
+	)
+	return err
+}
+
+// Fail は attempt 回目の試行の失敗を記録する。nextRunAt が nil なら再試行をやめて dead にする
+func (r *JobRepository) Fail(ctx context.Context, id string, attempt int, errMsg string, nextRunAt *time.Time) error {
+	_, err := r.conn.Exec(ctx,
+		`UPDATE jobs SET
+			status = CASE WHEN $4::timestamptz IS NULL THEN 'dead' ELSE 'queued' END,
+			run_at = COALESCE($4, run_at),
+			finished_at = CASE WHEN $4::timestamptz IS NULL THEN NOW() END,
+			locked_until = NULL, last_error = $3, updated_at = NOW()
+		 WHERE id = $1 AND attempts = $2 AND status = 'running'`,
+		id, attempt, errMsg, nextRunAt,
+	)
+	return err
+}
+
+func (r *JobRepository) GetJob(ctx context.Context, id string) (*domain.Job, error) {
+	job, err := scanJob(r.conn.QueryRow(ctx, "SELECT "+jobColumns+" FROM jobs WHERE id = $1", id))
+	if err == pgx.ErrNoRows {
+		return nil, ErrJobNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// GetJobs は queue のジョブを新しい順に取得する。status が nil なら全ての状態が対象
+func (r *JobRepository) GetJobs(ctx context.Context, queue string, status *string, cursor *domain.Cursor, limit int64) ([]domain.Job, *domain.Cursor, error) {
+	var cursorAt *time.Time
+	var cursorID *string
+	if cursor != nil {
+		cursorAt = &cursor.CreatedAt
+		cursorID = &cursor.ID
+	}
+
+	rows, err := r.conn.Query(ctx,
+		`SELECT `+jobColumns+`
+		 FROM jobs
+		 WHERE queue = $1
+		   AND ($2::text IS NULL OR status = $2)
+		   AND ($3::timestamptz IS NULL OR (created_at, id) < ($3, $4::uuid))
+		 ORDER BY created_at DESC, id DESC
+		 LIMIT $5`,
+		queue, status, cursorAt, cursorID, limit+1,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var jobs []domain.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *domain.Cursor
+	if int64(len(jobs)) > limit {
+		jobs = jobs[:limit]
+		next = &domain.Cursor{CreatedAt: jobs[limit-1].CreatedAt, ID: jobs[limit-1].ID}
+	}
+
+	return jobs, next, nil
+}
+
+// GetQueueStats はキューごとに状態別のジョブの件数を集計する
+func (r *JobRepository) GetQueueStats(ctx context.Context) ([]domain.JobQueueStats, error) {
+	rows, err := r.conn.Query(ctx,
+		`SELECT queue,
+			COUNT(*) FILTER (WHERE status = 'queued'),
+			COUNT(*) FILTER (WHERE status = 'running'),
+			COUNT(*) FILTER (WHERE status = 'succeeded'),
+			COUNT(*) FILTER (WHERE status = 'dead'),
+			MIN(run_at) FILTER (WHERE status = 'queued' AND run_at <= NOW())
+		 FROM jobs
+		 GROUP BY queue
+		 ORDER BY queue`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []domain.JobQueueStats
+	for rows.Next() {
+		var s domain.JobQueueStats
+		if err := rows.Scan(&s.Queue, &s.Queued, &s.Running, &s.Succeeded, &s.Dead, &s.OldestQueuedAt); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// Retry は dead のジョブを試行回数を0に戻して積み直す
+func (r *JobRepository) Retry(ctx context.Context, id string) (*domain.Job, error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	job, err := scanJob(tx.QueryRow(ctx,
+		`UPDATE jobs SET
+			status = 'queued', attempts = 0, run_at = NOW(), finished_at = NULL, updated_at = NOW()
+		 WHERE id = $1 AND status = 'dead'
+		 RETURNING `+jobColumns,
+		id,
+	))
+	if err == pgx.ErrNoRows {
+		var exists bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM jobs WHERE id = $1)", id).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, ErrJobNotDead
+		}
+		return nil, ErrJobNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, "SELECT pg_notify($1, $2)", JobsChannel, job.Queue); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// DeleteSucceededBefore は before より前に成功したジョブを削除し、削除した件数を返す
+// dead のジョブは原因を調べられるように残す
+func (r *JobRepository) DeleteSucceededBefore(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.conn.Exec(ctx,
+		"DELETE FROM jobs WHERE status = 'succeeded' AND finished_at < $1",
+		before,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func scanJob(row pgx.Row) (*domain.Job, error) {
+	var job domain.Job
+	var payload []byte
+	err := row.Scan(&job.ID, &job.Queue, &job.Kind, &payload, &job.Status, &job.Attempts, &job.MaxAttempts, &job.RunAt, &job.LockedUntil, &job.LastError, &job.FinishedAt, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	job.Payload = payload
+	return &job, nil
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type LikeRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewLikeRepository(conn *pgxpool.Pool) *LikeRepository {
+	return &LikeRepository{conn: conn}
+}
+
+// CreateLike は userID が tweetID にいいねする（既にいいね済みなら何もしない）
+// 新しくいいねできた場合だけ likes_count を加算し、ツイートの投稿者に通知する
+// 見えないツイート（鍵アカウントのツイート・ブロック関係にあるユーザーのツイート）は存在しないものとして ErrTweetNotFound を返す
+func (r *LikeRepository) CreateLike(ctx context.Context, userID, tweetID string) error {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// 投稿者の取得と同時にツイートの削除をブロックする
+	var authorID string
+	err = tx.QueryRow(ctx,
+		`SELECT t.user_id
+		 FROM tweets t
+		 INNER JOIN users u ON u.id = t.user_id
+		 WHERE t.id = $2
+		   AND (
+			NOT u.protected
+			OR t.user_id = $1
+			OR EXISTS (SELECT 1 FROM follows f WHERE f.follower_id = $1 AND f.followee_id = t.user_id)
+		   )
+		   AND NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.blocker_id = $1 AND b.blocked_id = t.user_id)
+			   OR (b.blocker_id = t.user_id AND b.blocked_id = $1)
+		   )
+		 FOR SHARE OF t`,
+		userID, tweetID,
+	).Scan(&authorID)
+	if err == pgx.ErrNoRows {
+		return ErrTweetNotFound
+	} else if err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx,
+		"INSERT INTO likes (user_id, tweet_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		userID, tweetID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE tweets SET likes_count = likes_count + 1 WHERE id = $1", tweetID); err != nil {
+		return err
+	}
+	if err := notifyTx(ctx, tx, authorID, userID, domain.NotificationLike, &tweetID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteLike はいいねを取り消す（いいねしていなくてもエラーにしない）
+// 通知は取り消さない（既に届いたものは残る）
+func (r *LikeRepository) DeleteLike(ctx context.Context, userID, tweetID string) error {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, "DELETE FROM likes WHERE user_id = $1 AND tweet_id = $2", userID, tweetID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE tweets SET likes_count = likes_count - 1 WHERE id = $1", tweetID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ListRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewListRepository(conn *pgxpool.Pool) *ListRepository {
+	return &ListRepository{conn: conn}
+}
+
+func (r *ListRepository) CreateList(ctx context.Context, listID, ownerID string, req domain.CreateListRequest) (*domain.List, error) {
+	var list domain.List
+	err := r.conn.QueryRow(ctx,
+		`INSERT INTO lists (id, owner_id, name, description, private) VALUES ($1, $2, $3, $4, $5)
+		 RETURNING id, owner_id, name, description, private, created_at, updated_at`,
+		listID, ownerID, req.Name, req.Description, req.Private,
+	).Scan(&list.ID, &list.OwnerID, &list.Name, &list.Description, &list.Private, &list.CreatedAt, &list.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+func (r *ListRepository) GetList(ctx context.Context, listID string) (*domain.List, error) {
+	var list domain.List
+	err := r.conn.QueryRow(ctx,
+		"SELECT id, owner_id, name, description, private, created_at, updated_at FROM lists WHERE id = $1",
+		listID,
+	).Scan(&list.ID, &list.OwnerID, &list.Name, &list.Description, &list.Private, &list.CreatedAt, &list.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrListNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// UpdateList は ownerID が持ち主のリストの nil でない項目だけを更新する
+// 非公開にしたときは他のユーザーの購読を解除する
+func (r *ListRepository) UpdateList(ctx context.Context, listID, ownerID string, req domain.UpdateListRequest) (*domain.List, error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var list domain.List
+	err = tx.QueryRow(ctx,
+		`UPDATE lists SET
+			name = COALESCE($3, name),
+			description = COALESCE($4, description),
+			private = COALESCE($5, private),
+			updated_at = NOW()
+		 WHERE id = $1 AND owner_id = $2
+		 RETURNING id, owner_id, name, description, private, created_at, updated_at`,
+		listID, ownerID, req.Name, req.Description, req.Private,
+	).Scan(&list.ID, &list.OwnerID, &list.Name, &list.Description, &list.Private, &list.CreatedAt, &list.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrListNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if list.Private {
+		if _, err := tx.Exec(ctx, "DELETE FROM list_subscriptions WHERE list_id = $1", listID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+func (r *ListRepository) DeleteList(ctx context.Context, listID, ownerID string) error {
+	tag, err := r.conn.Exec(ctx, "DELETE FROM lists WHERE id = $1 AND owner_id = $2", listID, ownerID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrListNotFound
+	}
+
+	return nil
+}
+
+// GetUserLists は userID が作ったリストと購読しているリストを作成日時の新しい順に取得する
+func (r *ListRepository) GetUserLists(ctx context.Context, userID string) ([]domain.List, error) {
+	rows, err := r.conn.Query(ctx,
+		`SELECT l.id, l.owner_id, l.name, l.description, l.private, l.created_at, l.updated_at
+		 FROM lists l
+		 WHERE l.owner_id = $1
+		    OR EXISTS (SELECT 1 FROM list_subscriptions s WHERE s.list_id = l.id AND s.user_id = $1)
+		 ORDER BY l.created_at DESC, l.id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lists []domain.List
+	for rows.Next() {
+		var list domain.List
+		if err := rows.Scan(&list.ID, &list.OwnerID, &list.Name, &list.Description, &list.Private, &list.CreatedAt, &list.UpdatedAt); err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+func (r *ListRepository) AddMember(ctx context.Context, listID, userID string) error {
+	_, err := r.conn.Exec(ctx,
+		"INSERT INTO list_members (list_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		listID, userID,
+	)
+	return err
+}
+
+func (r *ListRepository) RemoveMember(ctx context.Context, listID, userID string) error {
+	_, err := r.conn.Exec(ctx,
+		"DELETE FROM list_members WHERE list_id = $1 AND user_id = $2",
+		listID, userID,
+	)
+	return err
+}
+
+// GetMembers はリストのメンバーを追加日時の新しい順に取得する
+func (r *ListRepository) GetMembers(ctx context.Context, listID string, cursor *domain.Cursor, limit int64) ([]domain.User, *domain.Cursor, error) {
+	var cursorAt *time.Time
+	var cursorID *string
+	if cursor != nil {
+		cursorAt = &cursor.CreatedAt
+		cursorID = &cursor.ID
+	}
+
+	rows, err := r.conn.Query(ctx,
+		`SELECT u.id, u.name, u.followers_count, u.followees_count, u.tweets_count, u.protected, u.created_at, u.updated_at, lm.created_at
+		 FROM list_members lm
+		 INNER JOIN users u ON u.id = lm.user_id
+		 WHERE lm.list_id = $1
+		   AND ($2::timestamptz IS NULL OR (lm.created_at, lm.user_id) < ($2, $3::uuid))
+		 ORDER BY lm.created_at DESC, lm.user_id DESC
+		 LIMIT $4`,
+		listID, cursorAt, cursorID, limit+1,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var users []domain.User
+	var positions []time.Time
+	for rows.Next() {
+		var user domain.User
+		var at time.Time
+		if err := rows.Scan(&user.ID, &user.Name, &user.FollowersCount, &user.FolloweesCount, &user.TweetsCount, &user.Protected, &user.CreatedAt, &user.UpdatedAt, &at); err != nil {
+			return nil, nil, err
+		}
+		users = append(users, user)
+		positions = append(positions, at)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *domain.Cursor
+	if int64(len(users)) > limit {
+		users = users[:limit]
+		next = &domain.Cursor{CreatedAt: positions[limit-1], ID: users[limit-1].ID}
+	}
+
+	return users, next, nil
+}
+
+func (r *ListRepository) Subscribe(ctx context.Context, listID, userID string) error {
+	_, err := r.conn.Exec(ctx,
+		"INSERT INTO list_subscriptions (list_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		listID, userID,
+	)
+	return err
+}
+
+func (r *ListRepository) Unsubscribe(ctx context.Context, listID, userID string) error {
+	_, err := r.conn.Exec(ctx,
+		"DELETE FROM list_subscriptions WHERE list_id = $1 AND user_id = $2",
+		listID, userID,
+	)
+	return err
+}
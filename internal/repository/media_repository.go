@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type MediaRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewMediaRepository(conn *pgxpool.Pool) *MediaRepository {
+	return &MediaRepository{conn: conn}
+}
+
+// CreateMedia はストレージに保存済みの画像のメタデータを登録する
+func (r *MediaRepository) CreateMedia(ctx context.Context, userID, storageKey, thumbnailKey string, m domain.Media) (*domain.Media, error) {
+	err := r.conn.QueryRow(ctx,
+		`INSERT INTO media (id, user_id, content_type, size_bytes, width, height, storage_key, thumbnail_key, url, thumbnail_url)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		 RETURNING created_at`,
+		m.ID, userID, m.ContentType, m.SizeBytes, m.Width, m.Height, storageKey, thumbnailKey, m.URL, m.ThumbnailURL,
+	).Scan(&m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// GetTweetMedia は tweetIDs に添付された画像を1回のクエリで取得し、ツイートIDをキーに添付順で返す
+func (r *MediaRepository) GetTweetMedia(ctx context.Context, tweetIDs []string) (map[string][]domain.Media, error) {
+	media := make(map[string][]domain.Media)
+	if len(tweetIDs) == 0 {
+		return media, nil
+	}
+
+	rows, err := r.conn.Query(ctx,
+		`SELECT tm.tweet_id, m.id, m.content_type, m.size_bytes, m.width, m.height, m.url, m.thumbnail_url, m.created_at
+		 FROM tweet_media tm
+		 INNER JOIN media m ON m.id = tm.media_id
+		 WHERE tm.tweet_id = ANY($1::uuid[])
+		 ORDER BY tm.tweet_id, tm.position`,
+		tweetIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tweetID string
+		var m domain.Media
+		if err := rows.Scan(&tweetID, &m.ID, &m.ContentType, &m.SizeBytes, &m.Width, &m.Height, &m.URL, &m.ThumbnailURL, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		media[tweetID] = append(media[tweetID], m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return media, nil
+}
+
+// attachMediaTx はトランザクション内で userID がアップロードした画像を tweetID に添付する
+// 他人の画像・存在しない画像・別のツイートに添付済みの画像が含まれていれば ErrMediaNotFound
+func attachMediaTx(ctx context.Context, tx pgx.Tx, tweetID, userID string, mediaIDs []string) error {
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO tweet_media (tweet_id, media_id, position)
+		 SELECT $1, m.id, x.ord - 1
+		 FROM unnest($3::uuid[]) WITH ORDINALITY AS x(id, ord)
+		 INNER JOIN media m ON m.id = x.id AND m.user_id = $2`,
+		tweetID, userID, mediaIDs,
+	)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == pgerrcode.UniqueViolation {
+			return ErrMediaNotFound
+		}
+		return err
+	}
+	if tag.RowsAffected() != int64(len(mediaIDs)) {
+		return ErrMediaNotFound
+	}
+	return nil
+}
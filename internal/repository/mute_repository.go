@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type MuteRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewMuteRepository(conn *pgxpool.Pool) *MuteRepository {
+	return &MuteRepository{conn: conn}
+}
+
+func (r *MuteRepository) CreateMute(ctx context.Context, muterID, mutedID string) error {
+	_, err := r.conn.Exec(ctx,
+		"INSERT INTO mutes (muter_id, muted_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		muterID, mutedID,
+	)
+	return err
+}
+
+func (r *MuteRepository) DeleteMute(ctx context.Context, muterID, mutedID string) error {
+	_, err := r.conn.Exec(ctx,
+		"DELETE FROM mutes WHERE muter_id = $1 AND muted_id = $2",
+		muterID, mutedID,
+	)
+	return err
+}
+
+// CreateMutedWord はミュートワードを登録する
+// 同じワードが既にあれば期限だけ更新する
+func (r *MuteRepository) CreateMutedWord(ctx context.Context, id, userID, word string, expiresAt *time.Time) (*domain.MutedWord, error) {
+	var mw domain.MutedWord
+	err := r.conn.QueryRow(ctx,
+		`INSERT INTO muted_words (id, user_id, word, expires_at) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (user_id, lower(word)) DO UPDATE SET expires_at = EXCLUDED.expires_at
+		 RETURNING id, word, expires_at, created_at`,
+		id, userID, word, expiresAt,
+	).Scan(&mw.ID, &mw.Word, &mw.ExpiresAt, &mw.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mw, nil
+}
+
+// GetMutedWords は期限切れでないミュートワードを登録の新しい順に取得する
+func (r *MuteRepository) GetMutedWords(ctx context.Context, userID string) ([]domain.MutedWord, error) {
+	rows, err := r.conn.Query(ctx,
+		`SELECT id, word, expires_at, created_at
+		 FROM muted_words
+		 WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > NOW())
+		 ORDER BY created_at DESC, id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var words []domain.MutedWord
+	for rows.Next() {
+		var mw domain.MutedWord
+		if err := rows.Scan(&mw.ID, &mw.Word, &mw.ExpiresAt, &mw.CreatedAt); err != nil {
+			return nil, err
+		}
+		words = append(words, mw)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return words, nil
+}
+
+func (r *MuteRepository) DeleteMutedWord(ctx context.Context, userID, id string) error {
+	var deleted string
+	err := r.conn.QueryRow(ctx,
+		"DELETE FROM muted_words WHERE id = $1 AND user_id = $2 RETURNING id",
+		id, userID,
+	).Scan(&deleted)
+	if err == pgx.ErrNoRows {
+		return ErrMutedWordNotFound
+	}
+	return err
+}
@@ -0,0 +1,328 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// 1つの通知に載せるアクターの数
+const notificationActorsLimit = 3
+
+// 1ツイートで通知するメンションの上限（大量メンションによるスパム対策）
+const maxMentionsPerTweet = 10
+
+// メールアドレス（foo@example.com）をメンションとして拾わないよう、直前が英数字でない @ だけを対象にする
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_])@([A-Za-z0-9_]+)`)
+
+type NotificationRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewNotificationRepository(conn *pgxpool.Pool) *NotificationRepository {
+	return &NotificationRepository{conn: conn}
+}
+
+// GetNotifications は userID の通知を最後のアクティビティの新しい順に取得する
+// ブロック関係にあるアクターは表示せず、表示できるアクターが残らない通知は返さない
+func (r *NotificationRepository) GetNotifications(ctx context.Context, userID string, cursor *domain.Cursor, limit int64) ([]domain.Notification, *domain.Cursor, error) {
+	var cursorAt *time.Time
+	var cursorID *string
+	if cursor != nil {
+		cursorAt = &cursor.CreatedAt
+		cursorID = &cursor.ID
+	}
+
+	rows, err := r.conn.Query(ctx,
+		`SELECT n.id, n.type, n.tweet_id, n.actors_count, n.read_at IS NOT NULL, n.created_at, n.updated_at
+		 FROM notifications n
+		 WHERE n.user_id = $1
+		   AND ($2::timestamptz IS NULL OR (n.updated_at, n.id) < ($2, $3::uuid))
+		   AND EXISTS (
+			SELECT 1 FROM notification_actors na
+			WHERE na.notification_id = n.id
+			  AND NOT EXISTS (
+				SELECT 1 FROM blocks b
+				WHERE (b.blocker_id = $1 AND b.blocked_id = na.actor_id)
+				   OR (b.blocker_id = na.actor_id AND b.blocked_id = $1)
+			  )
+		   )
+		 ORDER BY n.updated_at DESC, n.id DESC
+		 LIMIT $4`,
+		userID, cursorAt, cursorID, limit+1,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var notifications []domain.Notification
+	for rows.Next() {
+		var n domain.Notification
+		if err := rows.Scan(&n.ID, &n.Type, &n.TweetID, &n.ActorsCount, &n.Read, &n.CreatedAt, &n.UpdatedAt); err != nil {
+			return nil, nil, err
+		}
+		notifications = append(notifications, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *domain.Cursor
+	if int64(len(notifications)) > limit {
+		notifications = notifications[:limit]
+		next = &domain.Cursor{CreatedAt: notifications[limit-1].UpdatedAt, ID: notifications[limit-1].ID}
+	}
+
+	if err := r.attachActors(ctx, userID, notifications); err != nil {
+		return nil, nil, err
+	}
+
+	return notifications, next, nil
+}
+
+// attachActors は各通知に新しい順で最大 notificationActorsLimit 人のアクターを1クエリで埋める
+func (r *NotificationRepository) attachActors(ctx context.Context, userID string, notifications []domain.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(notifications))
+	index := make(map[string]int, len(notifications))
+	for i, n := range notifications {
+		ids[i] = n.ID
+		index[n.ID] = i
+		notifications[i].Actors = []domain.User{}
+	}
+
+	rows, err := r.conn.Query(ctx,
+		`SELECT x.notification_id, u.id, u.name, u.followers_count, u.followees_count, u.tweets_count, u.protected, u.created_at, u.updated_at
+		 FROM (
+			SELECT na.notification_id, na.actor_id, na.created_at,
+				ROW_NUMBER() OVER (PARTITION BY na.notification_id ORDER BY na.created_at DESC, na.actor_id DESC) AS rn
+			FROM notification_actors na
+			WHERE na.notification_id = ANY($1::uuid[])
+			  AND NOT EXISTS (
+				SELECT 1 FROM blocks b
+				WHERE (b.blocker_id = $2 AND b.blocked_id = na.actor_id)
+				   OR (b.blocker_id = na.actor_id AND b.blocked_id = $2)
+			  )
+		 ) x
+		 INNER JOIN users u ON u.id = x.actor_id
+		 WHERE x.rn <= $3
+		 ORDER BY x.notification_id, x.rn`,
+		ids, userID, notificationActorsLimit,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var notificationID string
+		var u domain.User
+		if err := rows.Scan(&notificationID, &u.ID, &u.Name, &u.FollowersCount, &u.FolloweesCount, &u.TweetsCount, &u.Protected, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			return err
+		}
+		i := index[notificationID]
+		notifications[i].Actors = append(notifications[i].Actors, u)
+	}
+
+	return rows.Err()
+}
+
+// GetNotification は userID の通知を1件取得する。ブロックで表示できるアクターがいなければ ErrNotificationNotFound を返す
+func (r *NotificationRepository) GetNotification(ctx context.Context, userID, id string) (*domain.Notification, error) {
+	var n domain.Notification
+	err := r.conn.QueryRow(ctx,
+		`SELECT n.id, n.type, n.tweet_id, n.actors_count, n.read_at IS NOT NULL, n.created_at, n.updated_at
+		 FROM notifications n
+		 WHERE n.id = $2 AND n.user_id = $1`,
+		userID, id,
+	).Scan(&n.ID, &n.Type, &n.TweetID, &n.ActorsCount, &n.Read, &n.CreatedAt, &n.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotificationNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	notifications := []domain.Notification{n}
+	if err := r.attachActors(ctx, userID, notifications); err != nil {
+		return nil, err
+	}
+	if len(notifications[0].Actors) == 0 {
+		return nil, ErrNotificationNotFound
+	}
+	return &notifications[0], nil
+}
+
+// CountUnread は userID の未読通知の件数を返す
+func (r *NotificationRepository) CountUnread(ctx context.Context, userID string) (int64, error) {
+	var count int64
+	err := r.conn.QueryRow(ctx,
+		"SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL",
+		userID,
+	).Scan(&count)
+	return count, err
+}
+
+// MarkRead は userID の未読通知を既読にし、既読にした件数を返す
+// ids が空なら全ての未読通知が対象。他人の通知の ID は無視する
+func (r *NotificationRepository) MarkRead(ctx context.Context, userID string, ids []string) (int64, error) {
+	var filter []string
+	if len(ids) > 0 {
+		filter = ids
+	}
+
+	tag, err := r.conn.Exec(ctx,
+		`UPDATE notifications SET read_at = NOW()
+		 WHERE user_id = $1 AND read_at IS NULL
+		   AND ($2::uuid[] IS NULL OR id = ANY($2::uuid[]))`,
+		userID, filter,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// notifyTx は actorID のイベントを recipientID に通知する
+// 同じグループ（種類・ツイート）の未読通知があればそこにアクターを追加し、同じアクターは二重に数えない
+// アクターが増えたときはリアルタイム配信用に UserEventChannel へ NOTIFY する
+// 受信者が Webhook でイベントを購読していれば配信を積む
+// 自分自身へのイベント、ブロック関係にある相手・受信者がミュートしている相手からのイベントは通知しない
+func notifyTx(ctx context.Context, tx pgx.Tx, recipientID, actorID, kind string, tweetID *string) error {
+	if recipientID == actorID {
+		return nil
+	}
+
+	var suppressed bool
+	err := tx.QueryRow(ctx,
+		`SELECT EXISTS (
+			SELECT 1 FROM blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		) OR EXISTS (
+			SELECT 1 FROM mutes WHERE muter_id = $1 AND muted_id = $2
+		)`,
+		recipientID, actorID,
+	).Scan(&suppressed)
+	if err != nil {
+		return err
+	}
+	if suppressed {
+		return nil
+	}
+
+	// Webhook は通知のまとめ方とは関係なく、イベントごとに配信する
+	data := domain.WebhookEventData{UserID: recipientID, ActorID: actorID, TweetID: tweetID}
+	if err := enqueueWebhooksTx(ctx, tx, recipientID, kind, data); err != nil {
+		return err
+	}
+
+	groupKey := kind
+	if tweetID != nil {
+		groupKey = kind + ":" + *tweetID
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+
+	// 競合時は何も変えずに既存の未読通知の ID を返させる
+	var notificationID string
+	err = tx.QueryRow(ctx,
+		`INSERT INTO notifications (id, user_id, type, tweet_id, group_key)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (user_id, group_key) WHERE read_at IS NULL
+		 DO UPDATE SET group_key = EXCLUDED.group_key
+		 RETURNING id`,
+		id.String(), recipientID, kind, tweetID, groupKey,
+	).Scan(&notificationID)
+	if err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx,
+		`WITH inserted AS (
+			INSERT INTO notification_actors (notification_id, actor_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+			RETURNING notification_id
+		)
+		UPDATE notifications
+		SET actors_count = actors_count + 1, updated_at = NOW()
+		WHERE id IN (SELECT notification_id FROM inserted)`,
+		notificationID, actorID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	return notifyUserEventTx(ctx, tx, domain.TopicNotifications, notificationID, []string{recipientID})
+}
+
+// notifyMentionsTx は content 中の @name で言及されたユーザーに通知する
+// 鍵アカウントのツイートでは、ツイートを見られないフォロワー以外には通知しない
+func notifyMentionsTx(ctx context.Context, tx pgx.Tx, tweetID, authorID, content string) error {
+	names := parseMentions(content)
+	if len(names) == 0 {
+		return nil
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT u.id
+		 FROM users u
+		 WHERE u.name = ANY($1::text[])
+		   AND u.id != $2
+		   AND (
+			NOT EXISTS (SELECT 1 FROM users a WHERE a.id = $2 AND a.protected)
+			OR EXISTS (SELECT 1 FROM follows f WHERE f.follower_id = u.id AND f.followee_id = $2)
+		   )`,
+		names, authorID,
+	)
+	if err != nil {
+		return err
+	}
+	recipients, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+
+	// 通知行のロック順を揃える
+	sort.Strings(recipients)
+	for _, recipientID := range recipients {
+		if err := notifyTx(ctx, tx, recipientID, authorID, domain.NotificationMention, &tweetID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseMentions は content から重複なしで最大 maxMentionsPerTweet 個のユーザー名を取り出す
+func parseMentions(content string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		name := m[1]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+		if len(names) == maxMentionsPerTweet {
+			break
+		}
+	}
+	return names
+}
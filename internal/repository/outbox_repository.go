@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type OutboxRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewOutboxRepository(conn *pgxpool.Pool) *OutboxRepository {
+	return &OutboxRepository{conn: conn}
+}
+
+// ClaimDue は未配信のイベントを古い順に最大 limit 件取り出し、試行回数を増やす
+// 取り出したイベントの next_attempt_at は lease 後にずらすので、処理中にプロセスが落ちても lease が切れたら取り直される
+// SKIP LOCKED で取り合うため、複数インスタンスの relay が同じイベントを同時に配ることはない
+func (r *OutboxRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]domain.OutboxEvent, error) {
+	rows, err := r.conn.Query(ctx,
+		`UPDATE outbox SET
+			attempts = attempts + 1,
+			next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+		 WHERE id IN (
+			SELECT id FROM outbox
+			WHERE published_at IS NULL AND next_attempt_at <= NOW()
+			ORDER BY created_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING id, event_type, aggregate_id, payload, created_at, attempts`,
+		limit, lease.Seconds(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []domain.OutboxEvent
+	for rows.Next() {
+		var e domain.OutboxEvent
+		var payload []byte
+		if err := rows.Scan(&e.ID, &e.Type, &e.AggregateID, &payload, &e.CreatedAt, &e.Attempts); err != nil {
+			return nil, err
+		}
+		e.Payload = payload
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	// RETURNING の順序は保証されないので作成順に並べ直す
+	sortOutboxEvents(events)
+
+	if err := r.attachConsumed(ctx, events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// attachConsumed は前の試行で処理し終えた購読者を埋める
+func (r *OutboxRepository) attachConsumed(ctx context.Context, events []domain.OutboxEvent) error {
+	ids := make([]string, len(events))
+	index := make(map[string]int, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+		index[e.ID] = i
+	}
+
+	rows, err := r.conn.Query(ctx,
+		"SELECT event_id, consumer FROM outbox_consumed WHERE event_id = ANY($1::uuid[])",
+		ids,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var eventID, consumer string
+		if err := rows.Scan(&eventID, &consumer); err != nil {
+			return err
+		}
+		i := index[eventID]
+		events[i].Consumed = append(events[i].Consumed, consumer)
+	}
+	return rows.Err()
+}
+
+// MarkConsumed は consumer がイベントを処理し終えたことを記録する
+func (r *OutboxRepository) MarkConsumed(ctx context.Context, eventID, consumer string) error {
+	_, err := r.conn.Exec(ctx,
+		"INSERT INTO outbox_consumed (event_id, consumer) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		eventID, consumer,
+	)
+	return err
+}
+
+// MarkPublished は全ての購読者が処理し終えたイベントを配信済みにする
+func (r *OutboxRepository) MarkPublished(ctx context.Context, id string) error {
+	_, err := r.conn.Exec(ctx,
+		"UPDATE outbox SET published_at = NOW(), last_error = NULL WHERE id = $1",
+		id,
+	)
+	return err
+}
+
+// MarkFailed は処理に失敗した購読者がいたイベントを nextAttemptAt に取り直すようにする
+func (r *OutboxRepository) MarkFailed(ctx context.Context, id, errMsg string, nextAttemptAt time.Time) error {
+	_, err := r.conn.Exec(ctx,
+		"UPDATE outbox SET next_attempt_at = $2, last_error = $3 WHERE id = $1 AND published_at IS NULL",
+		id, nextAttemptAt, errMsg,
+	)
+	return err
+}
+
+// DeletePublishedBefore は before より前に配信済みになったイベントを削除し、削除した件数を返す
+func (r *OutboxRepository) DeletePublishedBefore(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.conn.Exec(ctx,
+		"DELETE FROM outbox WHERE published_at IS NOT NULL AND published_at < $1",
+		before,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// appendOutboxTx は変更と同じトランザクションで outbox にイベントを書き込む
+// コミットされた変更のイベントだけが配られ、ロールバックすればイベントも消える
+func appendOutboxTx(ctx context.Context, tx pgx.Tx, eventType, aggregateID string, payload any) error {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		"INSERT INTO outbox (id, event_type, aggregate_id, payload) VALUES ($1, $2, $3, $4)",
+		id.String(), eventType, aggregateID, data,
+	)
+	if err != nil {
+		return err
+	}
+
+	// 同じトランザクション内の同じ NOTIFY は Postgres がまとめるので、イベントが何件あっても1回しか届かない
+	_, err = tx.Exec(ctx, "SELECT pg_notify($1, '')", OutboxChannel)
+	return err
+}
+
+func sortOutboxEvents(events []domain.OutboxEvent) {
+	slices.SortFunc(events, func(a, b domain.OutboxEvent) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PollRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewPollRepository(conn *pgxpool.Pool) *PollRepository {
+	return &PollRepository{conn: conn}
+}
+
+// GetPolls は tweetIDs のうち投票付きのツイートの投票を1回のクエリで取得し、ツイートIDをキーにして返す
+// viewerID が空でなければ閲覧者の投票先も埋める
+func (r *PollRepository) GetPolls(ctx context.Context, viewerID string, tweetIDs []string) (map[string]*domain.Poll, error) {
+	polls := make(map[string]*domain.Poll)
+	if len(tweetIDs) == 0 {
+		return polls, nil
+	}
+
+	var viewer *string
+	if viewerID != "" {
+		viewer = &viewerID
+	}
+
+	rows, err := r.conn.Query(ctx,
+		`SELECT
+			p.tweet_id,
+			p.closes_at,
+			p.closes_at <= NOW(),
+			t.user_id = $2,
+			o.position,
+			o.label,
+			o.votes_count,
+			v.position
+		 FROM polls p
+		 INNER JOIN tweets t ON t.id = p.tweet_id
+		 INNER JOIN poll_options o ON o.tweet_id = p.tweet_id
+		 LEFT JOIN poll_votes v ON v.tweet_id = p.tweet_id AND v.user_id = $2
+		 WHERE p.tweet_id = ANY($1::uuid[])
+		 ORDER BY p.tweet_id, o.position`,
+		tweetIDs, viewer,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tweetID string
+		var poll domain.Poll
+		var isAuthor *bool
+		var option domain.PollOption
+		var votes int64
+		if err := rows.Scan(&tweetID, &poll.ClosesAt, &poll.Closed, &isAuthor, &option.Position, &option.Label, &votes, &poll.VotedOption); err != nil {
+			return nil, err
+		}
+
+		p, ok := polls[tweetID]
+		if !ok {
+			p = &poll
+			polls[tweetID] = p
+		}
+		p.TotalVotes += votes
+
+		// 投票前に途中経過を見せると結果に影響するので、件数は投票済み・締め切り後・投稿者本人にだけ返す
+		if p.VotedOption != nil || p.Closed || (isAuthor != nil && *isAuthor) {
+			option.VotesCount = &votes
+		}
+		p.Options = append(p.Options, option)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return polls, nil
+}
+
+// Vote は userID の票を入れる
+// 1ユーザー1票は poll_votes の主キーで保証し、二重投票は ErrAlreadyVoted になる
+// 見えないツイート（鍵アカウント・ブロック）の投票は ErrPollNotFound、締め切り後は ErrPollClosed
+func (r *PollRepository) Vote(ctx context.Context, tweetID, userID string, position int) error {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var closed bool
+	err = tx.QueryRow(ctx,
+		`SELECT p.closes_at <= NOW()
+		 FROM polls p
+		 INNER JOIN tweets t ON t.id = p.tweet_id
+		 INNER JOIN users u ON u.id = t.user_id
+		 WHERE p.tweet_id = $1
+		   AND (
+			NOT u.protected
+			OR t.user_id = $2
+			OR EXISTS (SELECT 1 FROM follows f WHERE f.follower_id = $2 AND f.followee_id = t.user_id)
+		   )
+		   AND NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.blocker_id = $2 AND b.blocked_id = t.user_id)
+			   OR (b.blocker_id = t.user_id AND b.blocked_id = $2)
+		   )`,
+		tweetID, userID,
+	).Scan(&closed)
+	if err == pgx.ErrNoRows {
+		return ErrPollNotFound
+	} else if err != nil {
+		return err
+	}
+	if closed {
+		return ErrPollClosed
+	}
+
+	_, err = tx.Exec(ctx,
+		"INSERT INTO poll_votes (tweet_id, user_id, position) VALUES ($1, $2, $3)",
+		tweetID, userID, position,
+	)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok {
+			switch pgErr.Code {
+			case pgerrcode.UniqueViolation:
+				return ErrAlreadyVoted
+			case pgerrcode.ForeignKeyViolation:
+				return ErrPollOptionNotFound
+			}
+		}
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE poll_options SET votes_count = votes_count + 1 WHERE tweet_id = $1 AND position = $2",
+		tweetID, position,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// insertPollTx はトランザクション内で tweetID のツイートに投票を付ける
+func insertPollTx(ctx context.Context, tx pgx.Tx, tweetID string, poll *domain.CreatePollRequest) error {
+	_, err := tx.Exec(ctx, "INSERT INTO polls (tweet_id, closes_at) VALUES ($1, $2)", tweetID, poll.ClosesAt)
+	if err != nil {
+		return err
+	}
+
+	for i, label := range poll.Options {
+		_, err := tx.Exec(ctx,
+			"INSERT INTO poll_options (tweet_id, position, label) VALUES ($1, $2, $3)",
+			tweetID, i, label,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"context"
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ScheduledTweetRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewScheduledTweetRepository(conn *pgxpool.Pool) *ScheduledTweetRepository {
+	return &ScheduledTweetRepository{conn: conn}
+}
+
+func (r *ScheduledTweetRepository) CreateScheduledTweet(ctx context.Context, id, userID, content string, publishAt time.Time) (*domain.ScheduledTweet, error) {
+	var st domain.ScheduledTweet
+	err := r.conn.QueryRow(ctx,
+		`INSERT INTO scheduled_tweets (id, user_id, content, publish_at)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING id, user_id, content, publish_at, created_at, updated_at`,
+		id, userID, content, publishAt,
+	).Scan(&st.ID, &st.UserID, &st.Content, &st.PublishAt, &st.CreatedAt, &st.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// GetScheduledTweets は userID の未公開の予約投稿を公開日時の早い順に取得する
+func (r *ScheduledTweetRepository) GetScheduledTweets(ctx context.Context, userID string) ([]domain.ScheduledTweet, error) {
+	rows, err := r.conn.Query(ctx,
+		`SELECT id, user_id, content, publish_at, created_at, updated_at
+		 FROM scheduled_tweets
+		 WHERE user_id = $1
+		 ORDER BY publish_at, id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scheduled []domain.ScheduledTweet
+	for rows.Next() {
+		var st domain.ScheduledTweet
+		if err := rows.Scan(&st.ID, &st.UserID, &st.Content, &st.PublishAt, &st.CreatedAt, &st.UpdatedAt); err != nil {
+			return nil, err
+		}
+		scheduled = append(scheduled, st)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return scheduled, nil
+}
+
+// UpdateScheduledTweet は nil でない項目だけを更新する
+// publisher が公開処理中の予約は行ロックの解放を待ち、公開済みなら ErrScheduledTweetNotFound になる
+func (r *ScheduledTweetRepository) UpdateScheduledTweet(ctx context.Context, id, userID string, req domain.UpdateScheduledTweetRequest) (*domain.ScheduledTweet, error) {
+	var st domain.ScheduledTweet
+	err := r.conn.QueryRow(ctx,
+		`UPDATE scheduled_tweets
+		 SET content = COALESCE($3, content),
+			publish_at = COALESCE($4, publish_at),
+			updated_at = NOW()
+		 WHERE id = $1 AND user_id = $2
+		 RETURNING id, user_id, content, publish_at, created_at, updated_at`,
+		id, userID, req.Content, req.PublishAt,
+	).Scan(&st.ID, &st.UserID, &st.Content, &st.PublishAt, &st.CreatedAt, &st.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrScheduledTweetNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// DeleteScheduledTweet は予約を取り消す。公開済みの予約は ErrScheduledTweetNotFound
+func (r *ScheduledTweetRepository) DeleteScheduledTweet(ctx context.Context, id, userID string) error {
+	tag, err := r.conn.Exec(ctx, "DELETE FROM scheduled_tweets WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrScheduledTweetNotFound
+	}
+	return nil
+}
+
+// PublishDue は公開日時を過ぎた予約を最大 limit 件 tweets に移し、公開した件数を返す
+// 対象行は FOR UPDATE SKIP LOCKED で取るため、複数インスタンスの publisher が同時に動いても同じ予約を二重に公開しない
+// ツイートの ID と created_at は実際に移した時刻ではなく publish_at に合わせる
+func (r *ScheduledTweetRepository) PublishDue(ctx context.Context, limit int) (int, error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`SELECT id, user_id, content, publish_at
+		 FROM scheduled_tweets
+		 WHERE publish_at <= NOW()
+		 ORDER BY publish_at
+		 LIMIT $1
+		 FOR UPDATE SKIP LOCKED`,
+		limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var due []domain.ScheduledTweet
+	for rows.Next() {
+		var st domain.ScheduledTweet
+		if err := rows.Scan(&st.ID, &st.UserID, &st.Content, &st.PublishAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, st)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(due) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]string, 0, len(due))
+	tweetIDs := make([]string, 0, len(due))
+	counts := make(map[string]int64)
+	for _, st := range due {
+		tweetID, err := newTweetIDAt(st.PublishAt)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(ctx,
+			"INSERT INTO tweets (id, user_id, content, created_at, updated_at) VALUES ($1, $2, $3, $4, $4)",
+			tweetID, st.UserID, st.Content, st.PublishAt,
+		)
+		if err != nil {
+			return 0, err
+		}
+		ids = append(ids, st.ID)
+		tweetIDs = append(tweetIDs, tweetID)
+		counts[st.UserID]++
+	}
+
+	// カウンタは他のトランザクションと同じくユーザーIDの昇順でロックする
+	userIDs := make([]string, 0, len(counts))
+	for userID := range counts {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+	for _, userID := range userIDs {
+		_, err := tx.Exec(ctx, "UPDATE users SET tweets_count = tweets_count + $2 WHERE id = $1", userID, counts[userID])
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// メンションの通知・ストリーミングへの配信・outbox のイベントは公開したときに行う
+	for i, st := range due {
+		if err := notifyMentionsTx(ctx, tx, tweetIDs[i], st.UserID, st.Content); err != nil {
+			return 0, err
+		}
+		if err := notifyTweetCreatedTx(ctx, tx, tweetIDs[i], st.UserID); err != nil {
+			return 0, err
+		}
+		if err := appendOutboxTx(ctx, tx, domain.EventTweetCreated, tweetIDs[i], domain.TweetEventPayload{TweetID: tweetIDs[i], UserID: st.UserID}); err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM scheduled_tweets WHERE id = ANY($1::uuid[])", ids)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return len(due), nil
+}
+
+// newTweetIDAt は先頭48ビットのタイムスタンプを at にした UUID v7 を作る
+// 予約投稿の ID を publish_at 時点で投稿されたツイートと同じ並びにするため
+func newTweetIDAt(at time.Time) (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(at.UnixMilli()))
+	copy(id[0:6], ms[2:8])
+
+	return id.String(), nil
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// おすすめの再計算間隔。友達の友達の集計は重いのでユーザーごとにこの間はキャッシュを返す
+	suggestionTTL = 1 * time.Hour
+	// 1ユーザーあたりに保持する候補の最大数
+	maxStoredSuggestions = 100
+)
+
+type SuggestionRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewSuggestionRepository(conn *pgxpool.Pool) *SuggestionRepository {
+	return &SuggestionRepository{conn: conn}
+}
+
+// GetSuggestions は userID へのおすすめユーザーを重なりの多い順に取得する
+// キャッシュが無いか TTL を過ぎていれば再計算してから返す
+// 計算後にフォロー・ブロックしたユーザーは読み出し時に除外する
+func (r *SuggestionRepository) GetSuggestions(ctx context.Context, userID string, limit int64) ([]domain.Suggestion, error) {
+	var fresh bool
+	err := r.conn.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM follow_suggestion_runs WHERE user_id = $1 AND computed_at > NOW() - $2::interval)",
+		userID, suggestionTTL,
+	).Scan(&fresh)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fresh {
+		if err := r.refresh(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := r.conn.Query(ctx,
+		`SELECT
+			u.id, u.name, u.followers_count, u.followees_count, u.tweets_count, u.protected, u.created_at, u.updated_at,
+			s.mutual_count,
+			fb.id, fb.name, fb.followers_count, fb.followees_count, fb.tweets_count, fb.protected, fb.created_at, fb.updated_at
+		 FROM follow_suggestions s
+		 INNER JOIN users u ON u.id = s.suggested_user_id
+		 INNER JOIN users fb ON fb.id = s.sample_followee_id
+		 WHERE s.user_id = $1
+		   AND NOT EXISTS (
+			SELECT 1 FROM follows f WHERE f.follower_id = $1 AND f.followee_id = s.suggested_user_id
+		   )
+		   AND NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.blocker_id = $1 AND b.blocked_id = s.suggested_user_id)
+			   OR (b.blocker_id = s.suggested_user_id AND b.blocked_id = $1)
+		   )
+		 ORDER BY s.mutual_count DESC, s.suggested_user_id
+		 LIMIT $2`,
+		userID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suggestions []domain.Suggestion
+	for rows.Next() {
+		var s domain.Suggestion
+		err := rows.Scan(
+			&s.User.ID, &s.User.Name, &s.User.FollowersCount, &s.User.FolloweesCount, &s.User.TweetsCount, &s.User.Protected, &s.User.CreatedAt, &s.User.UpdatedAt,
+			&s.MutualCount,
+			&s.FollowedBy.ID, &s.FollowedBy.Name, &s.FollowedBy.FollowersCount, &s.FollowedBy.FolloweesCount, &s.FollowedBy.TweetsCount, &s.FollowedBy.Protected, &s.FollowedBy.CreatedAt, &s.FollowedBy.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+// Invalidate は userID のおすすめのキャッシュを捨て、次の取得で再計算させる
+// 何度呼んでも結果は同じなので、outbox の購読者として同じイベントを重複して受け取ってもよい
+func (r *SuggestionRepository) Invalidate(ctx context.Context, userID string) error {
+	_, err := r.conn.Exec(ctx, "DELETE FROM follow_suggestion_runs WHERE user_id = $1", userID)
+	return err
+}
+
+// refresh は userID のおすすめを友達の友達の重なりから再計算して保存する
+// 同じユーザーへの同時リクエストで二重に計算しないよう advisory lock で直列化する
+func (r *SuggestionRepository) refresh(ctx context.Context, userID string) error {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('follow_suggestions:' || $1))", userID); err != nil {
+		return err
+	}
+
+	// ロック待ちの間に他のリクエストが計算し終えていれば何もしない
+	var fresh bool
+	err = tx.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM follow_suggestion_runs WHERE user_id = $1 AND computed_at > NOW() - $2::interval)",
+		userID, suggestionTTL,
+	).Scan(&fresh)
+	if err != nil {
+		return err
+	}
+	if fresh {
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM follow_suggestions WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	// f1: 自分 → フォロー中のユーザー、f2: フォロー中のユーザー → 候補
+	// 候補ごとに「候補をフォローしている自分のフォロー中ユーザー」の数を数える
+	_, err = tx.Exec(ctx,
+		`INSERT INTO follow_suggestions (user_id, suggested_user_id, mutual_count, sample_followee_id)
+		 SELECT
+			$1,
+			f2.followee_id,
+			COUNT(*),
+			(array_agg(f1.followee_id ORDER BY f1.created_at DESC))[1]
+		 FROM follows f1
+		 INNER JOIN follows f2 ON f2.follower_id = f1.followee_id
+		 WHERE f1.follower_id = $1
+		   AND f2.followee_id <> $1
+		   AND NOT EXISTS (
+			SELECT 1 FROM follows x WHERE x.follower_id = $1 AND x.followee_id = f2.followee_id
+		   )
+		 GROUP BY f2.followee_id
+		 ORDER BY COUNT(*) DESC, f2.followee_id
+		 LIMIT $2`,
+		userID, maxStoredSuggestions,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO follow_suggestion_runs (user_id, computed_at) VALUES ($1, NOW())
+		 ON CONFLICT (user_id) DO UPDATE SET computed_at = EXCLUDED.computed_at`,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
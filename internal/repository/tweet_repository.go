@@ -2,10 +2,12 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/Tetsu-is/social-media-scaling/internal/domain"
 	"github.com/google/uuid"
 	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -18,9 +20,42 @@ func NewTweetRepository(conn *pgxpool.Pool) *TweetRepository {
 	return &TweetRepository{conn: conn}
 }
 
-func (r *TweetRepository) CreateTweet(ctx context.Context, tweetID, userID, content string) (*domain.Tweet, error) {
+// CreateTweet はツイートを作成する。投票・画像の指定があれば同じトランザクションで付ける
+func (r *TweetRepository) CreateTweet(ctx context.Context, tweetID, userID string, req domain.PostTweetRequest) (*domain.Tweet, error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	tweet, err := insertTweetTx(ctx, tx, tweetID, userID, req.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Poll != nil {
+		if err := insertPollTx(ctx, tx, tweetID, req.Poll); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(req.MediaIDs) > 0 {
+		if err := attachMediaTx(ctx, tx, tweetID, userID, req.MediaIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return tweet, nil
+}
+
+// insertTweetTx はトランザクション内でツイートを作成し、投稿者の tweets_count を加算してメンションの通知と NOTIFY を行い、outbox にイベントを書き込む
+func insertTweetTx(ctx context.Context, tx pgx.Tx, tweetID, userID, content string) (*domain.Tweet, error) {
 	var tweet domain.Tweet
-	err := r.conn.QueryRow(ctx,
+	err := tx.QueryRow(ctx,
 		"INSERT INTO tweets (id, user_id, content) VALUES ($1, $2, $3) RETURNING id, user_id, content, likes_count, created_at, updated_at",
 		tweetID, userID, content,
 	).Scan(&tweet.ID, &tweet.UserID, &tweet.Content, &tweet.LikesCount, &tweet.CreatedAt, &tweet.UpdatedAt)
@@ -33,13 +68,52 @@ func (r *TweetRepository) CreateTweet(ctx context.Context, tweetID, userID, cont
 		return nil, err
 	}
 
+	_, err = tx.Exec(ctx, "UPDATE users SET tweets_count = tweets_count + 1 WHERE id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := notifyMentionsTx(ctx, tx, tweet.ID, userID, content); err != nil {
+		return nil, err
+	}
+
+	if err := notifyTweetCreatedTx(ctx, tx, tweet.ID, userID); err != nil {
+		return nil, err
+	}
+
+	if err := appendOutboxTx(ctx, tx, domain.EventTweetCreated, tweet.ID, domain.TweetEventPayload{TweetID: tweet.ID, UserID: userID}); err != nil {
+		return nil, err
+	}
+
 	return &tweet, nil
 }
 
-func (r *TweetRepository) GetTweets(ctx context.Context, offset, limit int64) ([]domain.Tweet, error) {
+// GetTweets は全ユーザーのツイートを新しい順に取得する
+// 鍵アカウントのツイートは本人とフォロワーにしか返さない
+// viewerID が空でなければ、閲覧者とブロック関係にあるユーザーのツイートも除外する
+func (r *TweetRepository) GetTweets(ctx context.Context, viewerID string, offset, limit int64) ([]domain.Tweet, error) {
+	var viewer *string
+	if viewerID != "" {
+		viewer = &viewerID
+	}
+
 	rows, err := r.conn.Query(ctx,
-		"SELECT id, user_id, content, likes_count, created_at, updated_at FROM tweets ORDER BY created_at DESC OFFSET $1 LIMIT $2",
-		offset, limit,
+		`SELECT t.id, t.user_id, t.content, t.likes_count, t.created_at, t.updated_at
+		 FROM tweets t
+		 INNER JOIN users u ON u.id = t.user_id
+		 WHERE (
+			NOT u.protected
+			OR t.user_id = $3
+			OR EXISTS (SELECT 1 FROM follows f WHERE f.follower_id = $3 AND f.followee_id = t.user_id)
+		 )
+		 AND ($3::uuid IS NULL OR NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.blocker_id = $3 AND b.blocked_id = t.user_id)
+			   OR (b.blocker_id = t.user_id AND b.blocked_id = $3)
+		 ))
+		 ORDER BY t.created_at DESC
+		 OFFSET $1 LIMIT $2`,
+		offset, limit, viewer,
 	)
 	if err != nil {
 		return nil, err
@@ -63,6 +137,247 @@ func (r *TweetRepository) GetTweets(ctx context.Context, offset, limit int64) ([
 	return tweets, nil
 }
 
+// DeleteTweet は userID 自身のツイートを削除する
+// 固定ツイートだった場合は users.pinned_tweet_id の ON DELETE SET NULL で固定も外れる
+func (r *TweetRepository) DeleteTweet(ctx context.Context, tweetID, userID string) error {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, "DELETE FROM tweets WHERE id = $1 AND user_id = $2", tweetID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTweetNotFound
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE users SET tweets_count = tweets_count - 1 WHERE id = $1", userID)
+	if err != nil {
+		return err
+	}
+
+	if err := appendOutboxTx(ctx, tx, domain.EventTweetDeleted, tweetID, domain.TweetEventPayload{TweetID: tweetID, UserID: userID}); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetPinnedTweet は userID の固定ツイートを取得する
+// 固定していない、または閲覧者から見えない（鍵アカウント・ブロック）場合は nil を返す
+func (r *TweetRepository) GetPinnedTweet(ctx context.Context, viewerID, userID string) (*domain.TweetWithUser, error) {
+	var viewer *string
+	if viewerID != "" {
+		viewer = &viewerID
+	}
+
+	var tweet domain.TweetWithUser
+	err := scanTweetWithUser(r.conn.QueryRow(ctx,
+		`SELECT
+			t.id,
+			t.user_id,
+			t.content,
+			t.likes_count,
+			t.created_at,
+			t.updated_at,
+			u.id,
+			u.name,
+			u.followers_count,
+			u.followees_count,
+			u.tweets_count,
+			u.protected,
+			u.created_at,
+			u.updated_at,
+			EXISTS (SELECT 1 FROM bookmarks bm WHERE bm.user_id = $2 AND bm.tweet_id = t.id)
+		 FROM users u
+		 INNER JOIN tweets t ON t.id = u.pinned_tweet_id
+		 WHERE u.id = $1
+		   AND (
+			NOT u.protected
+			OR u.id = $2
+			OR EXISTS (SELECT 1 FROM follows f WHERE f.follower_id = $2 AND f.followee_id = u.id)
+		   )
+		   AND ($2::uuid IS NULL OR NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.blocker_id = $2 AND b.blocked_id = u.id)
+			   OR (b.blocker_id = u.id AND b.blocked_id = $2)
+		   ))`,
+		userID, viewer,
+	), &tweet)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	tweet.Pinned = true
+	return &tweet, nil
+}
+
+// GetUserTweets は userID のツイートを新しい順に取得する（プロフィールのタイムライン）
+// 固定ツイートは先頭に別途表示するため、ここでは除外する
+// 鍵アカウントのツイートは本人とフォロワーにしか返さず、ブロック関係にある場合も返さない
+func (r *TweetRepository) GetUserTweets(ctx context.Context, viewerID, userID string, cursor *domain.Cursor, limit int64) ([]domain.TweetWithUser, *domain.Cursor, error) {
+	var viewer *string
+	if viewerID != "" {
+		viewer = &viewerID
+	}
+
+	var cursorAt *time.Time
+	var cursorID *string
+	if cursor != nil {
+		cursorAt = &cursor.CreatedAt
+		cursorID = &cursor.ID
+	}
+
+	rows, err := r.conn.Query(ctx,
+		`SELECT
+			t.id,
+			t.user_id,
+			t.content,
+			t.likes_count,
+			t.created_at,
+			t.updated_at,
+			u.id,
+			u.name,
+			u.followers_count,
+			u.followees_count,
+			u.tweets_count,
+			u.protected,
+			u.created_at,
+			u.updated_at,
+			EXISTS (SELECT 1 FROM bookmarks bm WHERE bm.user_id = $5 AND bm.tweet_id = t.id)
+		 FROM tweets t
+		 INNER JOIN users u ON u.id = t.user_id
+		 WHERE t.user_id = $1
+		   AND t.id IS DISTINCT FROM u.pinned_tweet_id
+		   AND ($2::timestamptz IS NULL OR (t.created_at, t.id) < ($2, $3::uuid))
+		   AND (
+			NOT u.protected
+			OR u.id = $5
+			OR EXISTS (SELECT 1 FROM follows f WHERE f.follower_id = $5 AND f.followee_id = u.id)
+		   )
+		   AND ($5::uuid IS NULL OR NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.blocker_id = $5 AND b.blocked_id = u.id)
+			   OR (b.blocker_id = u.id AND b.blocked_id = $5)
+		   ))
+		 ORDER BY t.created_at DESC, t.id DESC
+		 LIMIT $4`,
+		userID, cursorAt, cursorID, limit+1, viewer,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	tweets, err := collectTweetsWithUser(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var next *domain.Cursor
+	if int64(len(tweets)) > limit {
+		tweets = tweets[:limit]
+		last := tweets[limit-1]
+		next = &domain.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	return tweets, next, nil
+}
+
+// GetPublicUserTweets は公開のフィード（Atom / RSS・ActivityPub の outbox）用に userID のツイートを新しい順に取得する
+// 閲覧者がいない公開のフィードなので、鍵アカウントのツイートは返さない。固定ツイートも時系列の位置に含める
+func (r *TweetRepository) GetPublicUserTweets(ctx context.Context, userID string, cursor *domain.Cursor, limit int64) ([]domain.TweetWithUser, *domain.Cursor, error) {
+	var cursorAt *time.Time
+	var cursorID *string
+	if cursor != nil {
+		cursorAt = &cursor.CreatedAt
+		cursorID = &cursor.ID
+	}
+
+	rows, err := r.conn.Query(ctx,
+		`SELECT
+			t.id,
+			t.user_id,
+			t.content,
+			t.likes_count,
+			t.created_at,
+			t.updated_at,
+			u.id,
+			u.name,
+			u.followers_count,
+			u.followees_count,
+			u.tweets_count,
+			u.protected,
+			u.created_at,
+			u.updated_at,
+			FALSE
+		 FROM tweets t
+		 INNER JOIN users u ON u.id = t.user_id
+		 WHERE t.user_id = $1 AND NOT u.protected
+		   AND ($2::timestamptz IS NULL OR (t.created_at, t.id) < ($2, $3::uuid))
+		 ORDER BY t.created_at DESC, t.id DESC
+		 LIMIT $4`,
+		userID, cursorAt, cursorID, limit+1,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	tweets, err := collectTweetsWithUser(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var next *domain.Cursor
+	if int64(len(tweets)) > limit {
+		tweets = tweets[:limit]
+		last := tweets[limit-1]
+		next = &domain.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	return tweets, next, nil
+}
+
+// GetPublicTweet は公開のツイートを1件取得する。鍵アカウントのツイートは ErrTweetNotFound にする
+func (r *TweetRepository) GetPublicTweet(ctx context.Context, tweetID string) (*domain.TweetWithUser, error) {
+	var tweet domain.TweetWithUser
+	err := scanTweetWithUser(r.conn.QueryRow(ctx,
+		`SELECT
+			t.id,
+			t.user_id,
+			t.content,
+			t.likes_count,
+			t.created_at,
+			t.updated_at,
+			u.id,
+			u.name,
+			u.followers_count,
+			u.followees_count,
+			u.tweets_count,
+			u.protected,
+			u.created_at,
+			u.updated_at,
+			FALSE
+		 FROM tweets t
+		 INNER JOIN users u ON u.id = t.user_id
+		 WHERE t.id = $1 AND NOT u.protected`,
+		tweetID,
+	), &tweet)
+	if err == pgx.ErrNoRows {
+		return nil, ErrTweetNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &tweet, nil
+}
+
 func (r *TweetRepository) GetTweetsByMaxID(ctx context.Context, maxID uuid.UUID, count int64) ([]domain.Tweet, error) {
 	// 未実装
 	return nil, ErrNotImplemented
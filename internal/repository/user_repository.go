@@ -33,9 +33,9 @@ func (r *UserRepository) CreateUser(ctx context.Context, userID, name, password
 
 	var user domain.User
 	err = tx.QueryRow(ctx,
-		"INSERT INTO users (id, name) VALUES ($1, $2) RETURNING id, name, created_at, updated_at",
+		"INSERT INTO users (id, name) VALUES ($1, $2) RETURNING id, name, followers_count, followees_count, tweets_count, protected, created_at, updated_at",
 		userID, name,
-	).Scan(&user.ID, &user.Name, &user.CreatedAt, &user.UpdatedAt)
+	).Scan(&user.ID, &user.Name, &user.FollowersCount, &user.FolloweesCount, &user.TweetsCount, &user.Protected, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		if pgErr, ok := err.(*pgconn.PgError); ok {
 			if pgErr.Code == pgerrcode.UniqueViolation {
@@ -63,9 +63,9 @@ func (r *UserRepository) CreateUser(ctx context.Context, userID, name, password
 func (r *UserRepository) GetUserByName(ctx context.Context, name string) (*domain.User, error) {
 	var user domain.User
 	err := r.conn.QueryRow(ctx,
-		"SELECT id, name, created_at, updated_at FROM users WHERE name = $1",
+		"SELECT id, name, followers_count, followees_count, tweets_count, protected, created_at, updated_at FROM users WHERE name = $1",
 		name,
-	).Scan(&user.ID, &user.Name, &user.CreatedAt, &user.UpdatedAt)
+	).Scan(&user.ID, &user.Name, &user.FollowersCount, &user.FolloweesCount, &user.TweetsCount, &user.Protected, &user.CreatedAt, &user.UpdatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, ErrUserNotFound
 	} else if err != nil {
@@ -78,9 +78,9 @@ func (r *UserRepository) GetUserByName(ctx context.Context, name string) (*domai
 func (r *UserRepository) GetUserByID(ctx context.Context, userID string) (*domain.User, error) {
 	var user domain.User
 	err := r.conn.QueryRow(ctx,
-		"SELECT id, name, created_at, updated_at FROM users WHERE id = $1",
+		"SELECT id, name, followers_count, followees_count, tweets_count, protected, created_at, updated_at FROM users WHERE id = $1",
 		userID,
-	).Scan(&user.ID, &user.Name, &user.CreatedAt, &user.UpdatedAt)
+	).Scan(&user.ID, &user.Name, &user.FollowersCount, &user.FolloweesCount, &user.TweetsCount, &user.Protected, &user.CreatedAt, &user.UpdatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, ErrUserNotFound
 	} else if err != nil {
@@ -90,6 +90,105 @@ func (r *UserRepository) GetUserByID(ctx context.Context, userID string) (*domai
 	return &user, nil
 }
 
+// UpdateUser は nil でない項目だけを更新する。返すユーザーには本人向けの Settings も埋める
+// 鍵アカウントを解除したときは、承認待ちのフォローリクエストをすべて承認する
+func (r *UserRepository) UpdateUser(ctx context.Context, userID string, req domain.UpdateMeRequest) (*domain.User, error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	user := domain.User{Settings: &domain.UserSettings{}}
+	err = tx.QueryRow(ctx,
+		`UPDATE users SET
+			protected = COALESCE($2, protected),
+			dm_followees_only = COALESCE($3, dm_followees_only),
+			updated_at = NOW()
+		 WHERE id = $1
+		 RETURNING id, name, followers_count, followees_count, tweets_count, protected, created_at, updated_at, dm_followees_only`,
+		userID, req.Protected, req.DMFolloweesOnly,
+	).Scan(&user.ID, &user.Name, &user.FollowersCount, &user.FolloweesCount, &user.TweetsCount, &user.Protected, &user.CreatedAt, &user.UpdatedAt, &user.Settings.DMFolloweesOnly)
+	if err == pgx.ErrNoRows {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !user.Protected {
+		rows, err := tx.Query(ctx, "DELETE FROM follow_requests WHERE target_id = $1 RETURNING requester_id", userID)
+		if err != nil {
+			return nil, err
+		}
+		requesterIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, requesterID := range requesterIDs {
+			if err := insertFollowTx(ctx, tx, requesterID, userID); err != nil {
+				return nil, err
+			}
+		}
+
+		err = tx.QueryRow(ctx, "SELECT followers_count FROM users WHERE id = $1", userID).Scan(&user.FollowersCount)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetUserSettings は userID の本人向けの設定を取得する
+func (r *UserRepository) GetUserSettings(ctx context.Context, userID string) (*domain.UserSettings, error) {
+	var settings domain.UserSettings
+	err := r.conn.QueryRow(ctx,
+		"SELECT dm_followees_only FROM users WHERE id = $1",
+		userID,
+	).Scan(&settings.DMFolloweesOnly)
+	if err == pgx.ErrNoRows {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+// GetDMFolloweesOnly は userIDs の各ユーザーの dm_followees_only をまとめて取得する
+// 存在しないユーザーは結果に含まれない
+func (r *UserRepository) GetDMFolloweesOnly(ctx context.Context, userIDs []string) (map[string]bool, error) {
+	rows, err := r.conn.Query(ctx,
+		"SELECT id, dm_followees_only FROM users WHERE id = ANY($1::uuid[])",
+		userIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[string]bool, len(userIDs))
+	for rows.Next() {
+		var id string
+		var followeesOnly bool
+		if err := rows.Scan(&id, &followeesOnly); err != nil {
+			return nil, err
+		}
+		settings[id] = followeesOnly
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
 func (r *UserRepository) GetUserAuth(ctx context.Context, userID string) (*domain.UserAuth, error) {
 	var userAuth domain.UserAuth
 	err := r.conn.QueryRow(ctx,
@@ -112,3 +211,64 @@ func (r *UserRepository) CheckUserExists(ctx context.Context, userID string) (bo
 func (r *UserRepository) VerifyPassword(hashedPassword, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
+
+// ReconcileCounts は follows / tweets から各カウンタを再集計し、ずれているユーザーだけを修正する
+// 戻り値は修正したユーザー数
+func (r *UserRepository) ReconcileCounts(ctx context.Context) (int64, error) {
+	tag, err := r.conn.Exec(ctx, `
+		WITH followers AS (
+			SELECT followee_id AS user_id, COUNT(*) AS n FROM follows GROUP BY followee_id
+		), followees AS (
+			SELECT follower_id AS user_id, COUNT(*) AS n FROM follows GROUP BY follower_id
+		), tweet_counts AS (
+			SELECT user_id, COUNT(*) AS n FROM tweets GROUP BY user_id
+		), actual AS (
+			SELECT
+				u.id,
+				COALESCE(fr.n, 0) AS followers_count,
+				COALESCE(fe.n, 0) AS followees_count,
+				COALESCE(tc.n, 0) AS tweets_count
+			FROM users u
+			LEFT JOIN followers fr ON fr.user_id = u.id
+			LEFT JOIN followees fe ON fe.user_id = u.id
+			LEFT JOIN tweet_counts tc ON tc.user_id = u.id
+		)
+		UPDATE users u SET
+			followers_count = a.followers_count,
+			followees_count = a.followees_count,
+			tweets_count = a.tweets_count
+		FROM actual a
+		WHERE u.id = a.id
+		  AND (u.followers_count, u.followees_count, u.tweets_count)
+		      IS DISTINCT FROM (a.followers_count, a.followees_count, a.tweets_count)
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// PinTweet は userID 自身のツイートをプロフィールに固定する（既存の固定は置き換える）
+// 他人のツイートや存在しないツイートは ErrTweetNotFound
+func (r *UserRepository) PinTweet(ctx context.Context, userID, tweetID string) error {
+	tag, err := r.conn.Exec(ctx,
+		`UPDATE users SET pinned_tweet_id = $2, updated_at = NOW()
+		 WHERE id = $1
+		   AND EXISTS (SELECT 1 FROM tweets WHERE id = $2 AND user_id = $1)`,
+		userID, tweetID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTweetNotFound
+	}
+	return nil
+}
+
+// UnpinTweet は固定ツイートを外す（固定していなくてもエラーにしない）
+func (r *UserRepository) UnpinTweet(ctx context.Context, userID string) error {
+	_, err := r.conn.Exec(ctx, "UPDATE users SET pinned_tweet_id = NULL, updated_at = NOW() WHERE id = $1 AND pinned_tweet_id IS NOT NULL", userID)
+	return err
+}
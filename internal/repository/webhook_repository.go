@@ -0,0 +1,359 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// 1ユーザーが登録できる Webhook の数
+const maxWebhooksPerUser = 10
+
+type WebhookRepository struct {
+	conn *pgxpool.Pool
+}
+
+func NewWebhookRepository(conn *pgxpool.Pool) *WebhookRepository {
+	return &WebhookRepository{conn: conn}
+}
+
+// CreateWebhook は Webhook を登録する。上限に達していれば ErrWebhookLimitExceeded を返す
+func (r *WebhookRepository) CreateWebhook(ctx context.Context, id, userID, url, secret string, events []string) (*domain.Webhook, error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// 同時に登録されても上限を超えないよう、ユーザーの行をロックしてから数える
+	if _, err := tx.Exec(ctx, "SELECT 1 FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+		return nil, err
+	}
+	var count int
+	if err := tx.QueryRow(ctx, "SELECT COUNT(*) FROM webhooks WHERE user_id = $1", userID).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count >= maxWebhooksPerUser {
+		return nil, ErrWebhookLimitExceeded
+	}
+
+	var w domain.Webhook
+	err = tx.QueryRow(ctx,
+		`INSERT INTO webhooks (id, user_id, url, secret, events)
+		 VALUES ($1, $2, $3, $4, $5)
+		 RETURNING id, user_id, url, events, active, secret, created_at, updated_at`,
+		id, userID, url, secret, events,
+	).Scan(&w.ID, &w.UserID, &w.URL, &w.Events, &w.Active, &w.Secret, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+func (r *WebhookRepository) GetWebhook(ctx context.Context, id, userID string) (*domain.Webhook, error) {
+	var w domain.Webhook
+	err := r.conn.QueryRow(ctx,
+		"SELECT id, user_id, url, events, active, created_at, updated_at FROM webhooks WHERE id = $1 AND user_id = $2",
+		id, userID,
+	).Scan(&w.ID, &w.UserID, &w.URL, &w.Events, &w.Active, &w.CreatedAt, &w.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrWebhookNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// GetWebhooks は userID の Webhook を登録順に取得する
+func (r *WebhookRepository) GetWebhooks(ctx context.Context, userID string) ([]domain.Webhook, error) {
+	rows, err := r.conn.Query(ctx,
+		`SELECT id, user_id, url, events, active, created_at, updated_at
+		 FROM webhooks
+		 WHERE user_id = $1
+		 ORDER BY created_at, id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []domain.Webhook
+	for rows.Next() {
+		var w domain.Webhook
+		if err := rows.Scan(&w.ID, &w.UserID, &w.URL, &w.Events, &w.Active, &w.CreatedAt, &w.UpdatedAt); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (r *WebhookRepository) UpdateWebhook(ctx context.Context, id, userID string, req domain.UpdateWebhookRequest) (*domain.Webhook, error) {
+	var w domain.Webhook
+	err := r.conn.QueryRow(ctx,
+		`UPDATE webhooks SET
+			url = COALESCE($3, url),
+			events = COALESCE($4, events),
+			active = COALESCE($5, active),
+			updated_at = NOW()
+		 WHERE id = $1 AND user_id = $2
+		 RETURNING id, user_id, url, events, active, created_at, updated_at`,
+		id, userID, req.URL, req.Events, req.Active,
+	).Scan(&w.ID, &w.UserID, &w.URL, &w.Events, &w.Active, &w.CreatedAt, &w.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrWebhookNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// DeleteWebhook は Webhook を削除する。配信ログと配信待ちも一緒に消える
+func (r *WebhookRepository) DeleteWebhook(ctx context.Context, id, userID string) error {
+	tag, err := r.conn.Exec(ctx, "DELETE FROM webhooks WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// GetDeliveries は Webhook の配信ログを新しい順に取得する。status が nil なら全ての状態が対象
+func (r *WebhookRepository) GetDeliveries(ctx context.Context, webhookID, userID string, status *string, cursor *domain.Cursor, limit int64) ([]domain.WebhookDelivery, *domain.Cursor, error) {
+	if _, err := r.GetWebhook(ctx, webhookID, userID); err != nil {
+		return nil, nil, err
+	}
+
+	var cursorAt *time.Time
+	var cursorID *string
+	if cursor != nil {
+		cursorAt = &cursor.CreatedAt
+		cursorID = &cursor.ID
+	}
+
+	rows, err := r.conn.Query(ctx,
+		`SELECT `+webhookDeliveryColumns+`
+		 FROM webhook_deliveries
+		 WHERE webhook_id = $1
+		   AND ($2::text IS NULL OR status = $2)
+		   AND ($3::timestamptz IS NULL OR (created_at, id) < ($3, $4::uuid))
+		 ORDER BY created_at DESC, id DESC
+		 LIMIT $5`,
+		webhookID, status, cursorAt, cursorID, limit+1,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []domain.WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *domain.Cursor
+	if int64(len(deliveries)) > limit {
+		deliveries = deliveries[:limit]
+		next = &domain.Cursor{CreatedAt: deliveries[limit-1].CreatedAt, ID: deliveries[limit-1].ID}
+	}
+
+	return deliveries, next, nil
+}
+
+// Redeliver は配信をやり直す。dead になった配信も試行回数を0に戻して配信待ちに戻す
+func (r *WebhookRepository) Redeliver(ctx context.Context, webhookID, deliveryID, userID string) (*domain.WebhookDelivery, error) {
+	row := r.conn.QueryRow(ctx,
+		`UPDATE webhook_deliveries SET
+			status = 'pending', attempts = 0, next_attempt_at = NOW(), updated_at = NOW()
+		 WHERE id = $1 AND webhook_id = $2
+		   AND EXISTS (SELECT 1 FROM webhooks WHERE id = $2 AND user_id = $3)
+		 RETURNING `+webhookDeliveryColumns,
+		deliveryID, webhookID, userID,
+	)
+	d, err := scanWebhookDelivery(row)
+	if err == pgx.ErrNoRows {
+		return nil, ErrWebhookDeliveryNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// EnqueuePing は送信先の確認用に ping イベントを配信待ちに積む。購読しているイベントに関係なく送る
+func (r *WebhookRepository) EnqueuePing(ctx context.Context, webhookID, userID string) (*domain.WebhookDelivery, error) {
+	if _, err := r.GetWebhook(ctx, webhookID, userID); err != nil {
+		return nil, err
+	}
+
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	d, err := insertWebhookDeliveryTx(ctx, tx, webhookID, domain.WebhookEventPing, domain.WebhookEventData{UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// ClaimDue は送信時刻を過ぎた配信を最大 limit 件取り出し、試行回数を増やす
+// 取り出した配信の next_attempt_at は lease 後にずらすので、送信中にプロセスが落ちても lease が切れたら再送される
+// SKIP LOCKED で取り合うため、複数インスタンスで動かしても同じ配信を同時に送らない
+func (r *WebhookRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]domain.PendingWebhookDelivery, error) {
+	rows, err := r.conn.Query(ctx,
+		`UPDATE webhook_deliveries d SET
+			attempts = d.attempts + 1,
+			next_attempt_at = NOW() + $2 * INTERVAL '1 second',
+			updated_at = NOW()
+		 FROM webhooks w
+		 WHERE w.id = d.webhook_id
+		   AND d.id IN (
+			SELECT dd.id
+			FROM webhook_deliveries dd
+			INNER JOIN webhooks ww ON ww.id = dd.webhook_id
+			WHERE dd.status = 'pending' AND dd.next_attempt_at <= NOW() AND ww.active
+			ORDER BY dd.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF dd SKIP LOCKED
+		   )
+		 RETURNING d.id, w.url, w.secret, d.event, d.payload, d.attempts`,
+		limit, lease.Seconds(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []domain.PendingWebhookDelivery
+	for rows.Next() {
+		var d domain.PendingWebhookDelivery
+		if err := rows.Scan(&d.ID, &d.URL, &d.Secret, &d.Event, &d.Payload, &d.Attempts); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// MarkSucceeded は配信の成功を記録する
+func (r *WebhookRepository) MarkSucceeded(ctx context.Context, id string, statusCode int) error {
+	_, err := r.conn.Exec(ctx,
+		`UPDATE webhook_deliveries SET
+			status = 'succeeded', last_status_code = $2, last_error = NULL, delivered_at = NOW(), updated_at = NOW()
+		 WHERE id = $1 AND status = 'pending'`,
+		id, statusCode,
+	)
+	return err
+}
+
+// MarkFailed は配信の失敗を記録する。nextAttemptAt が nil なら再試行をやめて dead にする
+func (r *WebhookRepository) MarkFailed(ctx context.Context, id string, statusCode *int, errMsg string, nextAttemptAt *time.Time) error {
+	_, err := r.conn.Exec(ctx,
+		`UPDATE webhook_deliveries SET
+			status = CASE WHEN $4::timestamptz IS NULL THEN 'dead' ELSE 'pending' END,
+			next_attempt_at = COALESCE($4, next_attempt_at),
+			last_status_code = $2, last_error = $3, updated_at = NOW()
+		 WHERE id = $1 AND status = 'pending'`,
+		id, statusCode, errMsg, nextAttemptAt,
+	)
+	return err
+}
+
+// enqueueWebhooksTx は userID の有効な Webhook のうち event を購読しているものに配信を積む
+// イベントと同じトランザクションで書き込むので、ロールバックしたイベントは配信されない
+func enqueueWebhooksTx(ctx context.Context, tx pgx.Tx, userID, event string, data domain.WebhookEventData) error {
+	rows, err := tx.Query(ctx,
+		"SELECT id FROM webhooks WHERE user_id = $1 AND active AND $2 = ANY(events)",
+		userID, event,
+	)
+	if err != nil {
+		return err
+	}
+	webhookIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+
+	for _, webhookID := range webhookIDs {
+		if _, err := insertWebhookDeliveryTx(ctx, tx, webhookID, event, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertWebhookDeliveryTx(ctx context.Context, tx pgx.Tx, webhookID, event string, data domain.WebhookEventData) (*domain.WebhookDelivery, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(domain.WebhookPayload{
+		ID:        id.String(),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	row := tx.QueryRow(ctx,
+		`INSERT INTO webhook_deliveries (id, webhook_id, event, payload)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+webhookDeliveryColumns,
+		id.String(), webhookID, event, payload,
+	)
+	return scanWebhookDelivery(row)
+}
+
+const webhookDeliveryColumns = `id, webhook_id, event, payload, status, attempts, next_attempt_at, last_status_code, last_error, delivered_at, created_at, updated_at`
+
+func scanWebhookDelivery(row pgx.Row) (*domain.WebhookDelivery, error) {
+	var d domain.WebhookDelivery
+	var nextAttemptAt time.Time
+	var payload []byte
+	err := row.Scan(&d.ID, &d.WebhookID, &d.Event, &payload, &d.Status, &d.Attempts, &nextAttemptAt, &d.LastStatusCode, &d.LastError, &d.DeliveredAt, &d.CreatedAt, &d.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	d.Payload = payload
+	if d.Status == domain.WebhookDeliveryPending {
+		d.NextAttemptAt = &nextAttemptAt
+	}
+	return &d, nil
+}
@@ -0,0 +1,55 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/repository"
+)
+
+// publishBatchSize は1トランザクションで公開する予約投稿の最大件数
+const publishBatchSize = 100
+
+// Publisher は公開日時を過ぎた予約投稿を定期的に tweets に移す
+// 予約の取得は SKIP LOCKED なので、API サーバーを複数台動かしてもそれぞれで Run してよい
+type Publisher struct {
+	repo     *repository.ScheduledTweetRepository
+	interval time.Duration
+}
+
+func NewPublisher(repo *repository.ScheduledTweetRepository, interval time.Duration) *Publisher {
+	return &Publisher{repo: repo, interval: interval}
+}
+
+// Run は ctx がキャンセルされるまで interval ごとに予約投稿を公開する
+func (p *Publisher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.publishDue(ctx)
+		}
+	}
+}
+
+// publishDue は期限の来た予約がなくなるまでバッチ単位で公開する
+func (p *Publisher) publishDue(ctx context.Context) {
+	for {
+		n, err := p.repo.PublishDue(ctx, publishBatchSize)
+		if err != nil {
+			log.Println("failed to publish scheduled tweets:", err)
+			return
+		}
+		if n > 0 {
+			log.Printf("published %d scheduled tweets", n)
+		}
+		if n < publishBatchSize {
+			return
+		}
+	}
+}
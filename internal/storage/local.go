@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStorage はローカルのディレクトリにメディアを保存する（開発・単一インスタンス用）
+// 保存したファイルは Handler で配信する
+type LocalStorage struct {
+	dir     string
+	baseURL string
+}
+
+func NewLocalStorage(dir, baseURL string) *LocalStorage {
+	return &LocalStorage{dir: dir, baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// Put は一時ファイルに書いてから rename するので、書き込み途中のファイルが配信されることはない
+func (s *LocalStorage) Put(ctx context.Context, key, contentType string, body []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) URL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+// Handler は保存したファイルを key のパスで配信する
+// ディレクトリの一覧は返さない（メディアの ID を列挙できないようにするため）
+func (s *LocalStorage) Handler() http.Handler {
+	return http.FileServer(filesOnly{http.Dir(s.dir)})
+}
+
+// filesOnly はディレクトリを開こうとすると存在しないものとして扱う http.FileSystem
+type filesOnly struct {
+	fs http.FileSystem
+}
+
+func (f filesOnly) Open(name string) (http.File, error) {
+	file, err := f.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, fs.ErrNotExist
+	}
+	return file, nil
+}
+
+// path は key を保存先ディレクトリ配下のパスに変換する。ディレクトリの外を指す key はエラー
+func (s *LocalStorage) path(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", errors.New("invalid storage key")
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
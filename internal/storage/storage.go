@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Storage はアップロードされたメディアの保存先
+// key は "/" 区切りのパスで、URL はクライアントがそのまま取得できる公開 URL を返す
+type Storage interface {
+	Put(ctx context.Context, key, contentType string, body []byte) error
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// NewFromEnv は MEDIA_STORAGE（local または s3、既定は local）に応じた Storage を作る
+func NewFromEnv() (Storage, error) {
+	switch kind := getenv("MEDIA_STORAGE", "local"); kind {
+	case "local":
+		return NewLocalStorage(
+			getenv("MEDIA_DIR", "./media"),
+			getenv("MEDIA_BASE_URL", "http://localhost:8080/media"),
+		), nil
+	case "s3":
+		endpoint := os.Getenv("S3_ENDPOINT")
+		bucket := os.Getenv("S3_BUCKET")
+		if endpoint == "" || bucket == "" {
+			return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required for MEDIA_STORAGE=s3")
+		}
+		return NewS3Storage(S3Config{
+			Endpoint:  endpoint,
+			Bucket:    bucket,
+			Region:    getenv("S3_REGION", "us-east-1"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PublicURL: os.Getenv("S3_PUBLIC_URL"),
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown MEDIA_STORAGE: %s", kind)
+	}
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,202 @@
+package syndication
+
+import (
+	"encoding/xml"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// エントリのタイトルにする本文の先頭の文字数
+const titleLength = 50
+
+// Feed はフィードリーダー向けに配信するエントリの一覧。Atom と RSS のどちらでも書き出せる
+type Feed struct {
+	// 変わらない識別子（urn:uuid:...）
+	ID           string
+	Title        string
+	Description  string
+	SelfURL      string
+	AlternateURL string
+	Author       string
+	Updated      time.Time
+	Entries      []Entry
+}
+
+// Entry はフィードの1件（ツイート）
+type Entry struct {
+	ID         string
+	Content    string
+	Published  time.Time
+	Updated    time.Time
+	Enclosures []Enclosure
+}
+
+// Enclosure はエントリに添付する画像
+type Enclosure struct {
+	URL    string
+	Type   string
+	Length int64
+}
+
+// Title は本文の1行目を titleLength 文字までに切り詰めたもの
+func (e Entry) Title() string {
+	title, _, _ := strings.Cut(e.Content, "\n")
+	if utf8.RuneCountInString(title) <= titleLength {
+		return title
+	}
+	return string([]rune(title)[:titleLength]) + "…"
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length string `xml:"length,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Content   atomContent `xml:"content"`
+	Links     []atomLink  `xml:"link"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// WriteAtom は f を Atom 1.0 で書き出す
+func WriteAtom(w io.Writer, f Feed) error {
+	feed := atomFeed{
+		ID:      f.ID,
+		Title:   f.Title,
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Href: f.SelfURL, Type: "application/atom+xml"},
+			{Rel: "alternate", Href: f.AlternateURL},
+		},
+		Author: atomAuthor{Name: f.Author},
+	}
+	for _, e := range f.Entries {
+		entry := atomEntry{
+			ID:        e.ID,
+			Title:     e.Title(),
+			Published: e.Published.UTC().Format(time.RFC3339),
+			Updated:   e.Updated.UTC().Format(time.RFC3339),
+			Content:   atomContent{Type: "text", Body: e.Content},
+		}
+		for _, enc := range e.Enclosures {
+			entry.Links = append(entry.Links, atomLink{Rel: "enclosure", Href: enc.URL, Type: enc.Type, Length: strconv.FormatInt(enc.Length, 10)})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return encode(w, feed)
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	SelfLink      rssLink   `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Description string        `xml:"description"`
+	PubDate     string        `xml:"pubDate"`
+	GUID        rssGUID       `xml:"guid"`
+	Enclosure   *rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// WriteRSS は f を RSS 2.0 で書き出す。RSS の item に添付できるのは1つだけなので、最初の画像だけを載せる
+func WriteRSS(w io.Writer, f Feed) error {
+	feed := rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.AlternateURL,
+			Description:   f.Description,
+			LastBuildDate: f.Updated.UTC().Format(time.RFC1123Z),
+			SelfLink:      rssLink{Rel: "self", Href: f.SelfURL, Type: "application/rss+xml"},
+		},
+	}
+	for _, e := range f.Entries {
+		item := rssItem{
+			Title:       e.Title(),
+			Description: rssDescription(e.Content),
+			PubDate:     e.Published.UTC().Format(time.RFC1123Z),
+			GUID:        rssGUID{IsPermaLink: false, Value: e.ID},
+		}
+		if len(e.Enclosures) > 0 {
+			enc := e.Enclosures[0]
+			item.Enclosure = &rssEnclosure{URL: enc.URL, Length: enc.Length, Type: enc.Type}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	return encode(w, feed)
+}
+
+// rssDescription は本文を HTML にする。RSS の description はリーダーが HTML として表示するので、本文のタグはエスケープする
+func rssDescription(content string) string {
+	return strings.ReplaceAll(html.EscapeString(content), "\n", "<br>")
+}
+
+func encode(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return enc.Close()
+}
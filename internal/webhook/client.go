@@ -0,0 +1,82 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// NewHTTPClient は Webhook の送信に使う HTTP クライアントを作る
+// ユーザーが指定した URL に送るので、allowPrivate でなければループバック・プライベートなどのアドレスには接続しない（SSRF 対策）
+// 判定は名前解決した後の接続先で行うので、DNS で内部アドレスを返されても防げる。リダイレクトはたどらない
+func NewHTTPClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if allowPrivate {
+				return nil
+			}
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddr(addrPort.Addr()) {
+				return fmt.Errorf("webhook destination %s is not a public address", addrPort.Addr())
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: requestTimeout,
+			MaxIdleConnsPerHost:   2,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// ValidateURL は登録できる送信先の URL か確かめる
+// allowInsecure でなければ https だけを受け付ける（ローカルの受信サーバーで試すときは許可する）
+func ValidateURL(raw string, allowInsecure bool) error {
+	if len(raw) > 2048 {
+		return errors.New("url exceeds 2048 characters")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.New("invalid url")
+	}
+	if u.User != nil {
+		return errors.New("url must not contain credentials")
+	}
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if !allowInsecure {
+			return errors.New("url must use https")
+		}
+	default:
+		return errors.New("url must use https")
+	}
+	if !allowInsecure {
+		if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !isPublicAddr(addr) {
+			return errors.New("url must not point to a private address")
+		}
+	}
+	return nil
+}
+
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !addr.IsLoopback() && !addr.IsLinkLocalUnicast()
+}
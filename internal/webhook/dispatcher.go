@@ -0,0 +1,150 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/backoff"
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+	"github.com/Tetsu-is/social-media-scaling/internal/repository"
+)
+
+const (
+	// 1回に取り出す配信の数。取り出した分は並行に送る
+	claimBatchSize = 20
+	// 1回の送信のタイムアウト
+	requestTimeout = 10 * time.Second
+	// 取り出した配信を他のインスタンスに渡さない時間。requestTimeout より十分長くする
+	claimLease = time.Minute
+	// この回数失敗したら dead にする
+	maxAttempts = 8
+	// 読み捨てるレスポンスボディの上限
+	maxResponseBody = 64 << 10
+)
+
+// retryBackoff は送信に失敗した配信を送り直すまでの間隔（30秒, 1分, 2分, ... 最大1時間）
+var retryBackoff = backoff.Exponential{Base: 30 * time.Second, Max: time.Hour}
+
+// Dispatcher は webhook_deliveries の配信待ちを定期的に取り出して送信する
+// 配信待ちは SKIP LOCKED と lease でインスタンス間に分けるので、全インスタンスで Run しても同じ配信を同時に送ることはない
+type Dispatcher struct {
+	repo     *repository.WebhookRepository
+	client   *http.Client
+	interval time.Duration
+}
+
+func NewDispatcher(repo *repository.WebhookRepository, client *http.Client, interval time.Duration) *Dispatcher {
+	return &Dispatcher{repo: repo, client: client, interval: interval}
+}
+
+// Run は ctx がキャンセルされるまで interval ごとに配信待ちを送信する
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.dispatchDue(ctx)
+		}
+	}
+}
+
+// dispatchDue は送信時刻を過ぎた配信がなくなるまでバッチ単位で送信する
+func (d *Dispatcher) dispatchDue(ctx context.Context) {
+	for {
+		deliveries, err := d.repo.ClaimDue(ctx, claimBatchSize, claimLease)
+		if err != nil {
+			log.Println("failed to claim webhook deliveries:", err)
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.deliver(ctx, delivery)
+			}()
+		}
+		wg.Wait()
+
+		if len(deliveries) < claimBatchSize || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// deliver は1件送信し、結果を記録する。2xx 以外とリダイレクトは失敗として再試行する
+func (d *Dispatcher) deliver(ctx context.Context, delivery domain.PendingWebhookDelivery) {
+	statusCode, err := d.send(ctx, delivery)
+	if err == nil {
+		if err := d.repo.MarkSucceeded(ctx, delivery.ID, *statusCode); err != nil {
+			log.Println("failed to record webhook delivery:", err)
+		}
+		return
+	}
+
+	// 試行の上限に達したら dead にする。取り出し時に lease を延ばしてあるので記録に失敗しても後で再送される
+	var next *time.Time
+	if delivery.Attempts < maxAttempts {
+		at := time.Now().Add(retryBackoff.Delay(delivery.Attempts))
+		next = &at
+	}
+	if err := d.repo.MarkFailed(ctx, delivery.ID, statusCode, err.Error(), next); err != nil {
+		log.Println("failed to record webhook delivery:", err)
+	}
+}
+
+// send は署名付きで POST し、レスポンスのステータスコードを返す。接続できなかったときは nil
+func (d *Dispatcher) send(ctx context.Context, delivery domain.PendingWebhookDelivery) (*int, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "social-media-scaling-webhook/1.0")
+	req.Header.Set("X-Webhook-Id", delivery.ID)
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", "sha256="+Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return &resp.StatusCode, nil
+}
+
+// Sign は "<timestamp>.<body>" の HMAC-SHA256 を16進で返す
+// 受信側は X-Webhook-Timestamp と本文から同じ値を計算して X-Webhook-Signature と比べ、古すぎる timestamp は拒否する
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
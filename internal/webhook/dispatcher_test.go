@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/domain"
+)
+
+// verifySignature は受信側と同じ手順で X-Webhook-Signature を確かめる
+func verifySignature(r *http.Request, body []byte, secret string) bool {
+	timestamp, err := strconv.ParseInt(r.Header.Get("X-Webhook-Timestamp"), 10, 64)
+	if err != nil || time.Since(time.Unix(timestamp, 0)).Abs() > 5*time.Minute {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(r.Header.Get("X-Webhook-Timestamp") + "." + string(body)))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(r.Header.Get("X-Webhook-Signature")), []byte(want))
+}
+
+func TestSendSignsDelivery(t *testing.T) {
+	const secret = "whsec_test"
+	type received struct {
+		id, event string
+		body      []byte
+		verified  bool
+	}
+	got := make(chan received, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		got <- received{
+			id:       r.Header.Get("X-Webhook-Id"),
+			event:    r.Header.Get("X-Webhook-Event"),
+			body:     body,
+			verified: verifySignature(r, body, secret),
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	d := NewDispatcher(nil, srv.Client(), time.Second)
+	delivery := domain.PendingWebhookDelivery{
+		ID:      "0190d6f0-0000-7000-8000-000000000001",
+		URL:     srv.URL,
+		Secret:  secret,
+		Event:   domain.WebhookEventFollow,
+		Payload: []byte(`{"event":"follow"}`),
+	}
+
+	statusCode, err := d.send(context.Background(), delivery)
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if statusCode == nil || *statusCode != http.StatusNoContent {
+		t.Errorf("status code = %v, want 204", statusCode)
+	}
+
+	r := <-got
+	if !r.verified {
+		t.Error("receiver could not verify X-Webhook-Signature")
+	}
+	if r.id != delivery.ID || r.event != delivery.Event || string(r.body) != string(delivery.Payload) {
+		t.Errorf("received id=%q event=%q body=%q", r.id, r.event, r.body)
+	}
+}
+
+func TestSendReportsNon2xx(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	d := NewDispatcher(nil, srv.Client(), time.Second)
+	statusCode, err := d.send(context.Background(), domain.PendingWebhookDelivery{URL: srv.URL, Payload: []byte(`{}`)})
+	if err == nil {
+		t.Fatal("send returned no error for 503")
+	}
+	if statusCode == nil || *statusCode != http.StatusServiceUnavailable {
+		t.Errorf("status code = %v, want 503", statusCode)
+	}
+}
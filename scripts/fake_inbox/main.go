@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Tetsu-is/social-media-scaling/internal/activitypub"
+	"github.com/google/uuid"
+)
+
+// ActivityPub の配信を手元で試すための偽のリモートサーバー
+// 1人だけの actor を公開し、inbox に届いたアクティビティの署名を確かめて表示する
+// -follow に API の actor の URL を渡すと、起動時にその actor に Follow を送る
+// API サーバーは ACTIVITYPUB_ALLOW_INSECURE=1 で起動する（http・localhost に配信するため）
+//
+//	go run ./scripts/fake_inbox -follow http://localhost:8080/ap/users/<user id>
+func main() {
+	addr := flag.String("addr", ":9090", "listen address")
+	base := flag.String("base", "http://localhost:9090", "public url of this server")
+	follow := flag.String("follow", "", "actor url to follow on start")
+	flag.Parse()
+
+	publicPEM, privatePEM, err := activitypub.GenerateKey()
+	if err != nil {
+		log.Fatal("generate key:", err)
+	}
+	privateKey, err := activitypub.ParsePrivateKey(privatePEM)
+	if err != nil {
+		log.Fatal("parse key:", err)
+	}
+
+	actorURL := *base + "/actor"
+	keyID := actorURL + "#main-key"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /actor", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", activitypub.ContentType)
+		json.NewEncoder(w).Encode(map[string]any{
+			"@context":          []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"},
+			"id":                actorURL,
+			"type":              "Person",
+			"preferredUsername": "fake",
+			"inbox":             *base + "/inbox",
+			"publicKey":         activitypub.PublicKey{ID: keyID, Owner: actorURL, PublicKeyPEM: publicPEM},
+		})
+	})
+	mux.HandleFunc("POST /inbox", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		signer, err := activitypub.Verify(r, body, fetchKey)
+		if err != nil {
+			log.Println("rejected activity:", err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var pretty bytes.Buffer
+		json.Indent(&pretty, body, "", "  ")
+		fmt.Printf("--- activity signed by %s\n%s\n", signer, pretty.String())
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	if *follow != "" {
+		go func() {
+			// サーバーが起動してから送る（相手が actor ドキュメントを取りに来るため）
+			time.Sleep(500 * time.Millisecond)
+			if err := sendFollow(*follow, actorURL, keyID, privateKey); err != nil {
+				log.Println("follow:", err)
+			}
+		}()
+	}
+
+	log.Printf("fake inbox listening on %s (actor %s)", *addr, actorURL)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+// fetchKey は keyId の actor ドキュメントから公開鍵を取得する
+func fetchKey(ctx context.Context, keyID string) (*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, keyID, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", activitypub.ContentType)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var actor activitypub.RemoteActor
+	if err := json.NewDecoder(resp.Body).Decode(&actor); err != nil {
+		return nil, err
+	}
+	if actor.PublicKey.ID != keyID {
+		return nil, fmt.Errorf("actor does not have key %s", keyID)
+	}
+	return activitypub.ParsePublicKey(actor.PublicKey.PublicKeyPEM)
+}
+
+// sendFollow は target の inbox に署名した Follow を送る
+func sendFollow(target, actorURL, keyID string, key *rsa.PrivateKey) error {
+	client := activitypub.NewClient(http.DefaultClient)
+	ctx := context.Background()
+
+	remote, err := client.FetchActor(ctx, target, keyID, key)
+	if err != nil {
+		return err
+	}
+
+	activity, err := json.Marshal(activitypub.Activity{
+		Context: "https://www.w3.org/ns/activitystreams",
+		ID:      actorURL + "/follows/" + uuid.NewString(),
+		Type:    "Follow",
+		Actor:   actorURL,
+		Object:  remote.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := client.Deliver(ctx, remote.Inbox, activity, keyID, key); err != nil {
+		return err
+	}
+	log.Printf("sent follow to %s", remote.ID)
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/Tetsu-is/social-media-scaling/internal/repository"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -75,7 +76,7 @@ func generateTestData(ctx context.Context, pool *pgxpool.Pool) {
 	}
 
 	// --- 1. users ---
-	fmt.Printf("[1/4] users (%d件)...", numUsers)
+	fmt.Printf("[1/5] users (%d件)...", numUsers)
 	n, err := pool.CopyFrom(ctx,
 		pgx.Identifier{"users"},
 		[]string{"id", "name", "created_at", "updated_at"},
@@ -90,7 +91,7 @@ func generateTestData(ctx context.Context, pool *pgxpool.Pool) {
 	fmt.Printf(" %d件\n", n)
 
 	// --- 2. user_auth ---
-	fmt.Printf("[2/4] user_auth (%d件)...", numUsers)
+	fmt.Printf("[2/5] user_auth (%d件)...", numUsers)
 	n, err = pool.CopyFrom(ctx,
 		pgx.Identifier{"user_auth"},
 		[]string{"user_id", "hashed_password", "created_at", "updated_at"},
@@ -108,7 +109,7 @@ func generateTestData(ctx context.Context, pool *pgxpool.Pool) {
 	// ラウンドロビンでユーザーに割り当て → 時系列にユーザーが均等に混ぜられる
 	// 30日分に均等に分散 → created_at の分布がリアルなり
 	totalTweets := numUsers * tweetsPerUser
-	fmt.Printf("[3/4] tweets (%d件)...", totalTweets)
+	fmt.Printf("[3/5] tweets (%d件)...", totalTweets)
 
 	baseTime := time.Now().Add(-30 * 24 * time.Hour)
 	span := 30 * 24 * time.Hour
@@ -135,7 +136,7 @@ func generateTestData(ctx context.Context, pool *pgxpool.Pool) {
 
 	// --- 4. follows ---
 	// 各ユーザーが rand.Perm で重複なしに followsPerUser 人をフォロー
-	fmt.Printf("[4/4] follows (~%d件)...", numUsers*followsPerUser)
+	fmt.Printf("[4/5] follows (~%d件)...", numUsers*followsPerUser)
 
 	type followRow struct {
 		follower  string
@@ -171,6 +172,15 @@ func generateTestData(ctx context.Context, pool *pgxpool.Pool) {
 	}
 	fmt.Printf(" %d件\n", n)
 
+	// --- 5. counts ---
+	// COPY はカウンタ更新を経由しないので、最後にまとめて再集計する
+	fmt.Print("[5/5] counts...")
+	reconciled, err := repository.NewUserRepository(pool).ReconcileCounts(ctx)
+	if err != nil {
+		log.Fatal("counts:", err)
+	}
+	fmt.Printf(" %d件\n", reconciled)
+
 	fmt.Println("\nDone!")
 	fmt.Printf("  users: %d, tweets: %d, follows: %d\n", numUsers, totalTweets, len(follows))
 }
@@ -192,5 +202,10 @@ func cleanTestData(ctx context.Context, pool *pgxpool.Pool) {
 		}
 		fmt.Printf(" %s (%d件)", ct.String(), ct.RowsAffected())
 	}
+
+	// 残ったユーザーのフォロワー数などがテストユーザー分ずれるので再集計する
+	if _, err := repository.NewUserRepository(pool).ReconcileCounts(ctx); err != nil {
+		log.Fatal("counts:", err)
+	}
 	fmt.Println("\nDone!")
 }